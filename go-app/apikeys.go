@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// API 密钥以固定前缀开头，authMiddleware 据此与 JWT 区分；数据库中只保存 SHA-256 摘要
+const apiKeyPrefix = "rsk_"
+
+var validScopes = map[string]bool{"read": true, "upload": true, "write": true, "admin": true}
+
+type APIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Created    string     `json:"created"`
+}
+
+func hasScope(scopes []string, s string) bool {
+	for _, v := range scopes {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeAllows 判断 API 密钥的 scope 是否覆盖本次请求：
+// admin 允许一切；只读请求需要 read、upload 或 write；upload 只能调用上传接口；
+// 修改或删除资源、管理分享、退出登录等其余写操作需要 write。
+func scopeAllows(scopes []string, r *http.Request) bool {
+	if hasScope(scopes, "admin") {
+		return true
+	}
+	if r.Method == "GET" || r.Method == "HEAD" {
+		return hasScope(scopes, "read") || hasScope(scopes, "upload") || hasScope(scopes, "write")
+	}
+	if isUploadPath(r.URL.Path) && hasScope(scopes, "upload") {
+		return true
+	}
+	return hasScope(scopes, "write")
+}
+
+// isUploadPath 判断是否为 upload scope 可以调用的上传接口：普通上传和分块上传
+func isUploadPath(p string) bool {
+	return p == "/api/upload" || strings.HasPrefix(p, "/api/upload/chunk/")
+}
+
+// authenticateAPIKey 校验密钥并返回所属用户；没有 admin scope 的密钥一律按普通用户处理
+func (a *App) authenticateAPIKey(key string) (Principal, []string, error) {
+	var id, uid int
+	var role, scopes string
+	var expires sql.NullTime
+	err := a.db.QueryRow(`SELECT t.id,t.user_id,u.role,t.scopes,t.expires_at FROM api_tokens t
+		JOIN users u ON t.user_id=u.id WHERE t.token_hash=?`, hashToken(key)).
+		Scan(&id, &uid, &role, &scopes, &expires)
+	if err == sql.ErrNoRows {
+		return Principal{}, nil, fmt.Errorf("invalid api key")
+	} else if err != nil {
+		return Principal{}, nil, dbError(err)
+	}
+	now := time.Now()
+	if expires.Valid && now.After(expires.Time) {
+		return Principal{}, nil, fmt.Errorf("api key expired")
+	}
+	list := strings.Split(scopes, ",")
+	if !hasScope(list, "admin") {
+		role = "user"
+	}
+	// last_used_at 精确到分钟即可，避免每个请求都写库
+	if _, err := a.db.Exec("UPDATE api_tokens SET last_used_at=? WHERE id=? AND (last_used_at IS NULL OR last_used_at<?)",
+		now, id, now.Add(-time.Minute)); err != nil {
+		slog.Warn("update api key last_used_at failed", "token_id", id, "err", err)
+	}
+	return Principal{UserID: uid, Role: role}, list, nil
+}
+
+// handleAPITokens 处理 GET/POST /api/user/tokens 与 DELETE /api/user/tokens/{id}
+func (a *App) handleAPITokens(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Token-Scopes") != "" {
+		writeError(w, r, apiKeyNotAllowed)
+		return
+	}
+	p := principalFromRequest(r)
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/user/tokens"), "/")
+
+	switch {
+	case id == "" && r.Method == "GET":
+		a.listAPITokens(w, r, p)
+	case id == "" && r.Method == "POST":
+		a.createAPIToken(w, r, p)
+	case id != "" && r.Method == "DELETE":
+		err := affected(a.db.Exec("DELETE FROM api_tokens WHERE id=? AND user_id=?", id, p.UserID))
+		if errors.Is(err, ErrNotFound) {
+			writeError(w, r, apiKeyNotFound)
+			return
+		} else if err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		jsonResponse(w, map[string]string{"message": "已吊销"})
+	default:
+		writeError(w, r, apiMethodNotAllowed)
+	}
+}
+
+func (a *App) listAPITokens(w http.ResponseWriter, r *http.Request, p Principal) {
+	rows, err := a.db.Query(`SELECT id,name,token_prefix,scopes,expires_at,last_used_at,created_at
+		FROM api_tokens WHERE user_id=? ORDER BY id DESC`, p.UserID)
+	if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	defer rows.Close()
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		var scopes string
+		var expires, lastUsed sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &scopes, &expires, &lastUsed, &t.Created); err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		t.Scopes = strings.Split(scopes, ",")
+		if expires.Valid {
+			t.ExpiresAt = &expires.Time
+		}
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	jsonResponse(w, tokens)
+}
+
+func (a *App) createAPIToken(w http.ResponseWriter, r *http.Request, p Principal) {
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		writeError(w, r, apiKeyInvalidName)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		writeError(w, r, apiScopeRequired)
+		return
+	}
+	for _, s := range req.Scopes {
+		if !validScopes[s] {
+			writeError(w, r, apiInvalidScope.With(s))
+			return
+		}
+		if s == "admin" && !p.IsAdmin() {
+			writeError(w, r, apiAdminScopeDenied)
+			return
+		}
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > 3650 {
+		writeError(w, r, apiKeyInvalidLifetime)
+		return
+	}
+
+	key := apiKeyPrefix + randomToken(32)
+	var expires *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expires = &t
+	}
+	res, err := a.db.Exec(`INSERT INTO api_tokens (user_id,name,token_prefix,token_hash,scopes,expires_at)
+		VALUES (?,?,?,?,?,?)`, p.UserID, req.Name, key[:len(apiKeyPrefix)+6], hashToken(key),
+		strings.Join(req.Scopes, ","), expires)
+	if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	id, _ := res.LastInsertId()
+	// 明文密钥只在创建时返回一次
+	jsonResponse(w, map[string]interface{}{
+		"id": id, "name": req.Name, "token": key, "scopes": req.Scopes, "expires_at": expires,
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// 测试共用的密码哈希，bcrypt 较慢，只计算一次
+const testPassword = "secret99"
+
+var testPasswordHash string
+
+// TestMain 配置包级的全局依赖：JWT 密钥、本地存储、分块目录和进度存储。
+// 数据库不是全局的，每个测试通过 newTestApp 获得独立的内存库，可以并行执行。
+func TestMain(m *testing.M) {
+	initLogger(io.Discard)
+	dir, err := os.MkdirTemp("", "resapp-test-")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("JWT_SECRET", "0123456789abcdef0123456789abcdef")
+	uploadDir = dir + "/uploads"
+	chunkDir = dir + "/chunks"
+	if err := initJWTKeys(); err != nil {
+		panic(err)
+	}
+	if err := initStorage(); err != nil {
+		panic(err)
+	}
+	if err := initProgressStore(); err != nil {
+		panic(err)
+	}
+	if testPasswordHash, err = hashPassword(testPassword); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testApp 是在内存 SQLite 上运行的完整 API
+type testApp struct {
+	*App
+	t   *testing.T
+	srv *httptest.Server
+}
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+	conn, err := openSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newApp(conn, "sqlite")
+	if _, err := a.migrateUp(0); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(a.routes())
+	t.Cleanup(func() {
+		srv.Close()
+		conn.Close()
+	})
+	return &testApp{App: a, t: t, srv: srv}
+}
+
+// createUser 直接写入用户，密码为 testPassword
+func (ta *testApp) createUser(username, role string) int {
+	ta.t.Helper()
+	id, err := ta.users.Create(context.Background(), username, testPasswordHash, role)
+	if err != nil {
+		ta.t.Fatal(err)
+	}
+	return int(id)
+}
+
+// login 登录并返回访问令牌和刷新令牌
+func (ta *testApp) login(username string) (token, refresh string) {
+	ta.t.Helper()
+	var resp struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	ta.expectJSON(ta.do("POST", "/api/login", "", map[string]string{"username": username, "password": testPassword}), 200, &resp)
+	return resp.Token, resp.RefreshToken
+}
+
+// do 发送请求；body 为 []byte 时原样发送，其余值编码为 JSON
+func (ta *testApp) do(method, path, token string, body interface{}, headers ...string) *http.Response {
+	ta.t.Helper()
+	var rd io.Reader
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		rd = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			ta.t.Fatal(err)
+		}
+		rd = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, ta.srv.URL+path, rd)
+	if err != nil {
+		ta.t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := ta.srv.Client().Do(req)
+	if err != nil {
+		ta.t.Fatal(err)
+	}
+	return resp
+}
+
+// upload 通过 multipart 表单上传 content，返回资源 ID 和摘要
+func (ta *testApp) upload(token, name string, content []byte) (int, string) {
+	ta.t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		ta.t.Fatal(err)
+	}
+	fw.Write(content)
+	mw.Close()
+	var resp struct {
+		ID     int    `json:"id"`
+		SHA256 string `json:"sha256"`
+	}
+	ta.expectJSON(ta.do("POST", "/api/upload", token, buf.Bytes(), "Content-Type", mw.FormDataContentType()), 200, &resp)
+	return resp.ID, resp.SHA256
+}
+
+// expectJSON 检查状态码并把响应体解码到 v（v 可为 nil）
+func (ta *testApp) expectJSON(resp *http.Response, status int, v interface{}) {
+	ta.t.Helper()
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != status {
+		ta.t.Fatalf("%s %s: status %d, want %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status, data)
+	}
+	if v != nil {
+		if err := json.Unmarshal(data, v); err != nil {
+			ta.t.Fatalf("%s %s: decode %s: %v", resp.Request.Method, resp.Request.URL.Path, data, err)
+		}
+	}
+}
+
+// expectError 检查状态码和错误代码
+func (ta *testApp) expectError(resp *http.Response, status int, code string) {
+	ta.t.Helper()
+	var e struct {
+		Code string `json:"code"`
+	}
+	ta.expectJSON(resp, status, &e)
+	if e.Code != code {
+		ta.t.Fatalf("%s %s: code %q, want %q", resp.Request.Method, resp.Request.URL.Path, e.Code, code)
+	}
+}
+
+// expectBody 检查状态码并返回响应体
+func (ta *testApp) expectBody(resp *http.Response, status int) []byte {
+	ta.t.Helper()
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != status {
+		ta.t.Fatalf("%s %s: status %d, want %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status, data)
+	}
+	return data
+}
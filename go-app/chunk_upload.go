@@ -0,0 +1,445 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultChunkSize = 5 << 20
+	minChunkSize     = 1 << 20
+	maxChunkSize     = 100 << 20
+)
+
+// chunkLocks 串行化本实例内同一任务的分块登记；跨实例由 markChunkUploaded 的行锁
+// 和 complete 在数据库中认领任务（status 改为 merging）保证
+var chunkLocks sync.Map
+
+// 合并超过这个时间仍未结束的任务视为实例已退出，可以被重新认领
+const chunkMergeTimeout = time.Hour
+
+var errUploadClosed = errors.New("upload task is no longer accepting chunks")
+
+type UploadTask struct {
+	ID          string `json:"upload_id"`
+	UserID      int    `json:"-"`
+	FileName    string `json:"file_name"`
+	FileSize    int64  `json:"file_size"`
+	ChunkSize   int64  `json:"chunk_size"`
+	TotalChunks int    `json:"total_chunks"`
+	Uploaded    []int  `json:"uploaded"`
+	Status      string `json:"status"`
+	Progress    int    `json:"progress"`
+	Description string `json:"description"`
+	FilePath    string `json:"-"`
+	Category    string `json:"category"`
+	ResourceID  int64  `json:"resource_id,omitempty"`
+	Error       string `json:"error,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+const uploadTaskColumns = `id,COALESCE(user_id,0),COALESCE(file_name,''),COALESCE(file_size,0),
+	COALESCE(chunk_size,0),COALESCE(total_chunks,0),COALESCE(uploaded,''),COALESCE(status,''),
+	COALESCE(progress,0),COALESCE(description,''),COALESCE(file_path,''),COALESCE(category,''),
+	COALESCE(resource_id,0),COALESCE(error,''),COALESCE(created_at,0),COALESCE(updated_at,0)`
+
+func scanUploadTask(row rowScanner) (*UploadTask, error) {
+	var t UploadTask
+	var uploaded string
+	err := row.Scan(&t.ID, &t.UserID, &t.FileName, &t.FileSize, &t.ChunkSize, &t.TotalChunks,
+		&uploaded, &t.Status, &t.Progress, &t.Description, &t.FilePath, &t.Category,
+		&t.ResourceID, &t.Error, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	t.Uploaded = []int{}
+	if uploaded != "" {
+		json.Unmarshal([]byte(uploaded), &t.Uploaded)
+	}
+	return &t, nil
+}
+
+func (a *App) getUploadTask(id string) (*UploadTask, error) {
+	return scanUploadTask(a.db.QueryRow("SELECT "+uploadTaskColumns+" FROM upload_tasks WHERE id=?", id))
+}
+
+func chunkPath(taskID string, index int) string {
+	return filepath.Join(chunkDir, taskID, strconv.Itoa(index)+".part")
+}
+
+func (t *UploadTask) expectedChunkSize(index int) int64 {
+	if index == t.TotalChunks-1 {
+		return t.FileSize - int64(t.TotalChunks-1)*t.ChunkSize
+	}
+	return t.ChunkSize
+}
+
+func (t *UploadTask) hasChunk(index int) bool {
+	for _, i := range t.Uploaded {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *App) handleChunkInit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, r, apiMethodNotAllowed)
+		return
+	}
+	var req struct {
+		FileName    string `json:"file_name"`
+		FileSize    int64  `json:"file_size"`
+		ChunkSize   int64  `json:"chunk_size"`
+		Description string `json:"description"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	req.FileName = filepath.Base(req.FileName)
+	if req.FileName == "" || req.FileName == "." || req.FileSize <= 0 {
+		writeError(w, r, apiInvalidUploadInit)
+		return
+	}
+	if req.FileSize > maxUploadSize {
+		writeError(w, r, apiFileTooLarge)
+		return
+	}
+	if req.ChunkSize == 0 {
+		req.ChunkSize = defaultChunkSize
+	}
+	if req.ChunkSize < minChunkSize || req.ChunkSize > maxChunkSize {
+		writeError(w, r, apiInvalidChunkSize)
+		return
+	}
+
+	uid, _ := strconv.Atoi(r.Header.Get("X-User-ID"))
+	now := time.Now().Unix()
+	t := &UploadTask{
+		ID:          uuid.New().String(),
+		UserID:      uid,
+		FileName:    req.FileName,
+		FileSize:    req.FileSize,
+		ChunkSize:   req.ChunkSize,
+		TotalChunks: int((req.FileSize + req.ChunkSize - 1) / req.ChunkSize),
+		Uploaded:    []int{},
+		Status:      "pending",
+		Description: req.Description,
+		Category:    getCategoryFromFileType(getFileType(filepath.Ext(req.FileName))),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := os.MkdirAll(filepath.Join(chunkDir, t.ID), 0755); err != nil {
+		writeError(w, r, apiStorage.Wrap(err))
+		return
+	}
+	_, err := a.db.Exec(`INSERT INTO upload_tasks (id,user_id,file_name,file_size,chunk_size,total_chunks,
+		uploaded,status,progress,description,category,created_at,updated_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		t.ID, t.UserID, t.FileName, t.FileSize, t.ChunkSize, t.TotalChunks,
+		"[]", t.Status, 0, t.Description, t.Category, t.CreatedAt, t.UpdatedAt)
+	if err != nil {
+		os.RemoveAll(filepath.Join(chunkDir, t.ID))
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	jsonResponse(w, t)
+}
+
+// handleChunkOps 处理 /api/upload/chunk/{id}、/{id}/{index} 与 /{id}/complete
+func (a *App) handleChunkOps(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/upload/chunk/"), "/"), "/")
+	if parts[0] == "" || len(parts) > 2 {
+		writeError(w, r, apiNotFound)
+		return
+	}
+	t, err := a.getUploadTask(parts[0])
+	if err == sql.ErrNoRows {
+		writeError(w, r, apiUploadNotFound)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	if !canModify(principalFromRequest(r), t.UserID) {
+		writeError(w, r, apiUploadForbidden)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == "GET":
+		jsonResponse(w, t)
+	case len(parts) == 1 && r.Method == "DELETE":
+		a.handleChunkAbort(w, r, t)
+	case len(parts) == 2 && parts[1] == "complete" && r.Method == "POST":
+		a.handleChunkComplete(w, r, t)
+	case len(parts) == 2 && (r.Method == "PUT" || r.Method == "POST"):
+		index, err := strconv.Atoi(parts[1])
+		if err != nil || index < 0 || index >= t.TotalChunks {
+			writeError(w, r, apiInvalidChunkIndex)
+			return
+		}
+		a.handleChunkUpload(w, r, t, index)
+	default:
+		writeError(w, r, apiMethodNotAllowed)
+	}
+}
+
+func (a *App) handleChunkUpload(w http.ResponseWriter, r *http.Request, t *UploadTask, index int) {
+	if t.Status != "pending" && t.Status != "uploading" {
+		writeError(w, r, apiUploadFinished)
+		return
+	}
+	expected := t.expectedChunkSize(index)
+	r.Body = http.MaxBytesReader(w, r.Body, expected)
+
+	// 先写临时文件再重命名，避免中断后留下残缺的分块。同一分块可能被并发重传，
+	// 每个请求使用各自的临时文件，互不截断
+	final := chunkPath(t.ID, index)
+	if err := os.MkdirAll(filepath.Dir(final), 0755); err != nil {
+		writeError(w, r, apiStorage.Wrap(err))
+		return
+	}
+	f, err := os.CreateTemp(filepath.Dir(final), filepath.Base(final)+".*.tmp")
+	if err != nil {
+		writeError(w, r, apiStorage.Wrap(err))
+		return
+	}
+	tmp := f.Name()
+	written, err := io.Copy(f, r.Body)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		os.Remove(tmp)
+		writeError(w, r, apiStorage.Wrap(cerr))
+		return
+	}
+	if err != nil || written != expected {
+		os.Remove(tmp)
+		writeError(w, r, apiChunkSizeMismatch.With(expected))
+		return
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		os.Remove(tmp)
+		writeError(w, r, apiStorage.Wrap(err))
+		return
+	}
+
+	t, err = a.markChunkUploaded(t.ID, index)
+	if errors.Is(err, errUploadClosed) {
+		writeError(w, r, apiUploadFinished)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	jsonResponse(w, t)
+}
+
+func (a *App) markChunkUploaded(taskID string, index int) (*UploadTask, error) {
+	mu, _ := chunkLocks.LoadOrStore(taskID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	t, err := scanUploadTask(tx.QueryRow("SELECT "+uploadTaskColumns+" FROM upload_tasks WHERE id=?"+a.forUpdate(), taskID))
+	if err != nil {
+		return nil, err
+	}
+	// 读取之后任务可能已被其他实例开始合并或取消
+	if t.Status != "pending" && t.Status != "uploading" {
+		return nil, errUploadClosed
+	}
+	if !t.hasChunk(index) {
+		t.Uploaded = append(t.Uploaded, index)
+		sort.Ints(t.Uploaded)
+	}
+	t.Status = "uploading"
+	t.Progress = len(t.Uploaded) * 100 / t.TotalChunks
+	t.UpdatedAt = time.Now().Unix()
+	uploaded, _ := json.Marshal(t.Uploaded)
+	_, err = tx.Exec("UPDATE upload_tasks SET uploaded=?,status=?,progress=?,updated_at=? WHERE id=?",
+		string(uploaded), t.Status, t.Progress, t.UpdatedAt, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	return t, tx.Commit()
+}
+
+// writeUploadState 按任务当前状态响应无法合并的 complete 请求；已完成时返回合并结果
+func writeUploadState(w http.ResponseWriter, r *http.Request, t *UploadTask) {
+	switch t.Status {
+	case "completed":
+		jsonResponse(w, map[string]interface{}{
+			"id": t.ResourceID, "category": t.Category, "message": "上传成功", "upload_id": t.ID,
+		})
+	case "cancelled":
+		writeError(w, r, apiUploadCancelled)
+	case "merging":
+		writeError(w, r, apiUploadMerging)
+	default:
+		writeError(w, r, apiChunksIncomplete.With(len(t.Uploaded), t.TotalChunks))
+	}
+}
+
+func (a *App) handleChunkComplete(w http.ResponseWriter, r *http.Request, t *UploadTask) {
+	if t.Status == "completed" || t.Status == "cancelled" || len(t.Uploaded) != t.TotalChunks {
+		writeUploadState(w, r, t)
+		return
+	}
+	// 在数据库中认领任务：多个实例同时 complete 时只有一个能把状态改为 merging 并合并分块，
+	// 其余按认领后的状态响应
+	now := time.Now().Unix()
+	err := affected(a.db.Exec(`UPDATE upload_tasks SET status='merging',updated_at=?
+		WHERE id=? AND (status IN ('pending','uploading','error') OR (status='merging' AND updated_at<?))`,
+		now, t.ID, now-int64(chunkMergeTimeout.Seconds())))
+	if errors.Is(err, ErrNotFound) {
+		if t, err = a.getUploadTask(t.ID); err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		writeUploadState(w, r, t)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+
+	ext := filepath.Ext(t.FileName)
+	newName := uuid.New().String() + ext
+	cr := &chunkReader{task: t}
+	hr := newHashingReader(cr)
+	written, err := storage.Put(r.Context(), newName, hr, t.FileSize)
+	cr.Close()
+	if err != nil {
+		storage.Delete(r.Context(), newName)
+		a.failUploadTask(t.ID, "合并分块失败")
+		writeError(w, r, apiStorage.Wrap(err))
+		return
+	}
+	digest := hr.Sum()
+	key, err := a.acquireBlob(r.Context(), newName, digest, written)
+	if err != nil {
+		storage.Delete(r.Context(), newName)
+		a.failUploadTask(t.ID, "数据库写入失败")
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+
+	ft := getFileType(ext)
+	id, err := a.resources.Create(r.Context(), &Resource{
+		OrigName: t.FileName, Size: written, Category: t.Category, Description: t.Description,
+		StorageKey: key, SHA256: digest, FileType: ft, UploaderID: t.UserID,
+	})
+	if err != nil {
+		a.releaseBlob(r.Context(), digest, key)
+		a.failUploadTask(t.ID, "数据库写入失败")
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	// 资源已经入库，任务状态写入失败只记录日志，不能让客户端重试而产生重复资源
+	if _, err := a.db.Exec("UPDATE upload_tasks SET status='completed',progress=100,file_path=?,resource_id=?,updated_at=? WHERE id=?",
+		key, id, time.Now().Unix(), t.ID); err != nil {
+		reqLogger(r).Error("mark upload task completed failed", "upload_id", t.ID, "resource_id", id, "err", err)
+	}
+	os.RemoveAll(filepath.Join(chunkDir, t.ID))
+	chunkLocks.Delete(t.ID)
+	uploadBytes.WithLabelValues("chunked").Add(float64(written))
+	uploadDuration.WithLabelValues("chunked").Observe(float64(time.Now().Unix() - t.CreatedAt))
+
+	jsonResponse(w, map[string]interface{}{
+		"id":        id,
+		"category":  t.Category,
+		"message":   "上传成功",
+		"upload_id": t.ID,
+		"sha256":    digest,
+	})
+}
+
+// chunkReader 按序号依次读取任务的全部分块，合并时无需先在本地拼出完整文件
+type chunkReader struct {
+	task  *UploadTask
+	index int
+	cur   *os.File
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.cur == nil {
+			if c.index >= c.task.TotalChunks {
+				return 0, io.EOF
+			}
+			f, err := os.Open(chunkPath(c.task.ID, c.index))
+			if err != nil {
+				return 0, err
+			}
+			c.cur = f
+			c.index++
+		}
+		n, err := c.cur.Read(p)
+		if err == io.EOF {
+			c.cur.Close()
+			c.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.cur != nil {
+		return c.cur.Close()
+	}
+	return nil
+}
+
+func (a *App) failUploadTask(id, msg string) {
+	if _, err := a.db.Exec("UPDATE upload_tasks SET status='error',error=?,updated_at=? WHERE id=?",
+		msg, time.Now().Unix(), id); err != nil {
+		slog.Error("mark upload task failed", "upload_id", id, "err", err)
+	}
+}
+
+func (a *App) handleChunkAbort(w http.ResponseWriter, r *http.Request, t *UploadTask) {
+	// 条件更新：正在合并或已完成的任务不能取消，否则会删掉合并中的分块
+	err := affected(a.db.Exec("UPDATE upload_tasks SET status='cancelled',updated_at=? WHERE id=? AND status NOT IN ('merging','completed')",
+		time.Now().Unix(), t.ID))
+	if errors.Is(err, ErrNotFound) {
+		if t, err = a.getUploadTask(t.ID); err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+		} else if t.Status == "merging" {
+			writeError(w, r, apiUploadMerging)
+		} else {
+			writeError(w, r, apiUploadCompleted)
+		}
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	os.RemoveAll(filepath.Join(chunkDir, t.ID))
+	chunkLocks.Delete(t.ID)
+	jsonResponse(w, map[string]string{"message": "已取消"})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChunkUploadComplete(t *testing.T) {
+	t.Parallel()
+	ta := newTestApp(t)
+	ta.createUser("alice", "user")
+	ta.createUser("bob", "user")
+	alice, _ := ta.login("alice")
+	bob, _ := ta.login("bob")
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), (minChunkSize+minChunkSize/2)/16)
+	var task UploadTask
+	ta.expectJSON(ta.do("POST", "/api/upload/chunk/init", alice, map[string]interface{}{
+		"file_name": "big.bin", "file_size": len(content), "chunk_size": minChunkSize,
+	}), 200, &task)
+	if task.TotalChunks != 2 {
+		t.Fatalf("total_chunks %d, want 2", task.TotalChunks)
+	}
+	base := "/api/upload/chunk/" + task.ID
+
+	ta.expectError(ta.do("PUT", base+"/0", bob, content[:minChunkSize]), 403, "UPLOAD_FORBIDDEN")
+	ta.expectError(ta.do("PUT", base+"/2", alice, content[minChunkSize:]), 400, "INVALID_CHUNK_INDEX")
+	ta.expectError(ta.do("PUT", base+"/1", alice, content[minChunkSize+1:]), 400, "CHUNK_SIZE_MISMATCH")
+	ta.expectJSON(ta.do("PUT", base+"/1", alice, content[minChunkSize:]), 200, nil)
+	ta.expectError(ta.do("POST", base+"/complete", alice, nil), 409, "CHUNKS_INCOMPLETE")
+	ta.expectJSON(ta.do("PUT", base+"/0", alice, content[:minChunkSize]), 200, nil)
+
+	// 失败的分块不能留下临时文件
+	entries, err := os.ReadDir(filepath.Join(chunkDir, task.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("chunk dir has %d entries, want 2", len(entries))
+	}
+
+	var done struct {
+		ID     int    `json:"id"`
+		SHA256 string `json:"sha256"`
+	}
+	ta.expectJSON(ta.do("POST", base+"/complete", alice, nil), 200, &done)
+	sum := sha256.Sum256(content)
+	if done.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("sha256 %s, want %x", done.SHA256, sum)
+	}
+	body := ta.expectBody(ta.do("GET", fmt.Sprintf("/api/download/%d", done.ID), "", nil), 200)
+	if !bytes.Equal(body, content) {
+		t.Fatalf("downloaded %d bytes, want the %d uploaded", len(body), len(content))
+	}
+	if _, err := os.Stat(filepath.Join(chunkDir, task.ID)); !os.IsNotExist(err) {
+		t.Fatalf("chunk dir not removed after complete: %v", err)
+	}
+
+	// 重复 complete 返回同一个资源，不会重复入库
+	var again struct {
+		ID int `json:"id"`
+	}
+	ta.expectJSON(ta.do("POST", base+"/complete", alice, nil), 200, &again)
+	if again.ID != done.ID {
+		t.Fatalf("second complete returned resource %d, want %d", again.ID, done.ID)
+	}
+	ta.expectError(ta.do("PUT", base+"/0", alice, content[:minChunkSize]), 409, "UPLOAD_FINISHED")
+}
+
+// initChunkTask 创建一个分块已全部上传的任务
+func initChunkTask(ta *testApp, token string, content []byte) string {
+	ta.t.Helper()
+	var task UploadTask
+	ta.expectJSON(ta.do("POST", "/api/upload/chunk/init", token, map[string]interface{}{
+		"file_name": "big.bin", "file_size": len(content), "chunk_size": minChunkSize,
+	}), 200, &task)
+	for i := 0; i < task.TotalChunks; i++ {
+		end := min((i+1)*minChunkSize, len(content))
+		ta.expectJSON(ta.do("PUT", fmt.Sprintf("/api/upload/chunk/%s/%d", task.ID, i), token, content[i*minChunkSize:end]), 200, nil)
+	}
+	return task.ID
+}
+
+func TestChunkCompleteClaim(t *testing.T) {
+	t.Parallel()
+	ta := newTestApp(t)
+	ta.createUser("alice", "user")
+	alice, _ := ta.login("alice")
+	id := initChunkTask(ta, alice, bytes.Repeat([]byte("x"), minChunkSize+10))
+	base := "/api/upload/chunk/" + id
+
+	// 模拟另一个实例正在合并
+	if _, err := ta.db.Exec("UPDATE upload_tasks SET status='merging',updated_at=? WHERE id=?", time.Now().Unix(), id); err != nil {
+		t.Fatal(err)
+	}
+	ta.expectError(ta.do("POST", base+"/complete", alice, nil), 409, "UPLOAD_MERGING")
+	ta.expectError(ta.do("DELETE", base, alice, nil), 409, "UPLOAD_MERGING")
+	ta.expectError(ta.do("PUT", base+"/0", alice, bytes.Repeat([]byte("x"), minChunkSize)), 409, "UPLOAD_FINISHED")
+
+	// 合并超时的认领可以被接管
+	stale := time.Now().Add(-chunkMergeTimeout - time.Minute).Unix()
+	if _, err := ta.db.Exec("UPDATE upload_tasks SET updated_at=? WHERE id=?", stale, id); err != nil {
+		t.Fatal(err)
+	}
+	ta.expectJSON(ta.do("POST", base+"/complete", alice, nil), 200, nil)
+	ta.expectError(ta.do("DELETE", base, alice, nil), 409, "UPLOAD_COMPLETED")
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+const usage = `usage: resapp <command> [arguments]
+
+  serve                                      start the HTTP server (default)
+  migrate up [version] | down [steps] | status
+  user create [-role user|admin] [-password-file FILE] USERNAME
+  user reset-password [-password-file FILE] USERNAME
+  user set-role USERNAME user|admin
+  resource import [-description D] [-visibility V] [-uploader USERNAME] FILE...
+  resource import-dir [-mode copy|link] [-visibility V] [-description D] [-uploader USERNAME] DIR
+                                             import a directory tree, resuming an unfinished run of DIR
+  resource delete ID...
+  resource reindex                           compute sha256 for resources uploaded before dedup
+  gc                                         remove expired tokens, links and abandoned chunk uploads
+  reconcile [-dry-run]                       quarantine orphan objects and stale temp/chunk files, report dangling rows
+  stats [-rollup]                            print totals; -rollup refreshes the stats tables
+
+All commands read the same environment variables as the server (DB_DRIVER, STORAGE_DRIVER, ...).
+Passwords are read from the first line of -password-file, or from stdin when it is omitted.
+`
+
+// 子命令共用服务端的配置、仓储和存储，用于初始化和修复部署
+var commands = map[string]func(args []string) error{
+	"serve":     runServe,
+	"migrate":   runMigrateCommand,
+	"user":      runUserCommand,
+	"resource":  runResourceCommand,
+	"gc":        runGCCommand,
+	"reconcile": runReconcileCommand,
+	"stats":     runStatsCommand,
+	"help":      runHelp,
+}
+
+var errUsage = errors.New("invalid arguments, run `resapp help` for usage")
+
+// openCLI 按服务端相同的环境变量连接数据库和存储，并确保 schema 已是最新
+func openCLI() (*App, error) {
+	a, err := openApp()
+	if err != nil {
+		return nil, err
+	}
+	if err := initStorage(); err != nil {
+		a.db.Close()
+		return nil, err
+	}
+	if err := a.prepareSchema(); err != nil {
+		a.db.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// newFlags 创建子命令的 FlagSet，参数错误时打印用法
+func newFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	return fs
+}
+
+// readPassword 读取 file 的第一行，未指定时从标准输入读取一行。
+// 不提供命令行参数形式，避免密码出现在 ps 和 shell 历史中。
+func readPassword(file string) (string, error) {
+	in := io.Reader(os.Stdin)
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		in = f
+	} else {
+		fmt.Fprint(os.Stderr, "password: ")
+	}
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func validRole(role string) bool {
+	return role == "user" || role == "admin"
+}
+
+// findUser 按用户名查找用户，返回带 ID 和角色的凭据
+func (a *App) findUser(ctx context.Context, username string) (UserCredentials, error) {
+	c, err := a.users.Credentials(ctx, username)
+	if errors.Is(err, ErrNotFound) {
+		return c, fmt.Errorf("user %q not found", username)
+	}
+	return c, err
+}
+
+func runUserCommand(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	sub, args := args[0], args[1:]
+	fs := newFlags("user " + sub)
+	role := "user"
+	var passwordFile string
+	switch sub {
+	case "create":
+		fs.StringVar(&role, "role", "user", "user or admin")
+		fs.StringVar(&passwordFile, "password-file", "", "file holding the password, read from stdin when omitted")
+	case "reset-password":
+		fs.StringVar(&passwordFile, "password-file", "", "file holding the password, read from stdin when omitted")
+	case "set-role":
+	default:
+		return errUsage
+	}
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	args = fs.Args()
+	if sub == "set-role" {
+		if len(args) != 2 {
+			return errUsage
+		}
+		role = args[1]
+		args = args[:1]
+	}
+	if len(args) != 1 || !validRole(role) {
+		return errUsage
+	}
+	username := args[0]
+
+	a, err := openCLI()
+	if err != nil {
+		return err
+	}
+	defer a.db.Close()
+	ctx := context.Background()
+
+	var hash string
+	if sub != "set-role" {
+		pw, err := readPassword(passwordFile)
+		if err != nil {
+			return err
+		}
+		if len(pw) < 6 {
+			return errors.New("password must be at least 6 characters")
+		}
+		if hash, err = hashPassword(pw); err != nil {
+			return err
+		}
+	}
+
+	if sub == "create" {
+		if len(username) < 3 {
+			return errors.New("username must be at least 3 characters")
+		}
+		id, err := a.users.Create(ctx, username, hash, role)
+		if errors.Is(err, ErrConflict) {
+			return fmt.Errorf("user %q already exists", username)
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("created %s %q (id %d)\n", role, username, id)
+		return nil
+	}
+
+	c, err := a.findUser(ctx, username)
+	if err != nil {
+		return err
+	}
+	if sub == "set-role" && role != "admin" {
+		last, err := a.isLastAdmin(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+		if last {
+			return fmt.Errorf("%q is the last administrator, promote another user first", username)
+		}
+	}
+	// Update 会递增 token_version，已签发的访问令牌随之失效
+	if hash != "" {
+		err = a.users.Update(ctx, c.ID, nil, nil, &hash)
+	} else {
+		err = a.users.Update(ctx, c.ID, nil, &role, nil)
+	}
+	if err != nil {
+		return err
+	}
+	if hash != "" {
+		if err := a.revokeUserRefreshTokens(c.ID); err != nil {
+			return err
+		}
+		fmt.Printf("password reset for %q, existing sessions revoked\n", username)
+	} else {
+		fmt.Printf("%q is now %s\n", username, role)
+	}
+	return nil
+}
+
+func runResourceCommand(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	sub, args := args[0], args[1:]
+	fs := newFlags("resource " + sub)
+	var opts ImportOptions
+	var uploader, mode string
+	if sub == "import" || sub == "import-dir" {
+		fs.StringVar(&opts.Description, "description", "", "description for files without a .desc sidecar or folder")
+		fs.StringVar(&opts.Visibility, "visibility", "public", "public, private or unlisted")
+		fs.StringVar(&uploader, "uploader", "", "username recorded as the uploader")
+	}
+	if sub == "import-dir" {
+		fs.StringVar(&mode, "mode", "copy", "copy files into storage, or hard-link them into UPLOAD_DIR")
+	}
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	args = fs.Args()
+	switch sub {
+	case "import", "delete":
+		if len(args) == 0 {
+			return errUsage
+		}
+	case "import-dir":
+		if len(args) != 1 {
+			return errUsage
+		}
+	case "reindex":
+		if len(args) != 0 {
+			return errUsage
+		}
+	default:
+		return errUsage
+	}
+	if opts.Visibility != "" && !validVisibility[opts.Visibility] {
+		return errUsage
+	}
+
+	a, err := openCLI()
+	if err != nil {
+		return err
+	}
+	defer a.db.Close()
+	ctx := context.Background()
+
+	if uploader != "" {
+		c, err := a.findUser(ctx, uploader)
+		if err != nil {
+			return err
+		}
+		opts.UploaderID = c.ID
+	}
+
+	switch sub {
+	case "import":
+		failed := 0
+		for _, path := range args {
+			res, err := a.importFile(ctx, path, opts)
+			if err != nil {
+				slog.Error("import failed", "file", path, "err", err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s\tresource %d\t%s\t%s\n", path, res.ID, res.Category, res.SHA256)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d files failed to import", failed, len(args))
+		}
+	case "import-dir":
+		return a.importDir(ctx, args[0], mode, opts)
+	case "delete":
+		for _, arg := range args {
+			if err := a.deleteResource(ctx, arg); err != nil {
+				return err
+			}
+			fmt.Printf("deleted resource %s\n", arg)
+		}
+	case "reindex":
+		n, err := a.backfillDigests(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("computed sha256 for %d resources\n", n)
+	}
+	return nil
+}
+
+// deleteResource 与 DELETE /api/resources/{id} 相同：先删记录，再释放存储中的对象
+func (a *App) deleteResource(ctx context.Context, id string) error {
+	res, err := a.getResource(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("resource %s not found", id)
+	} else if err != nil {
+		return err
+	}
+	if err := a.resources.Delete(ctx, res.ID); err != nil {
+		return err
+	}
+	if err := a.releaseBlob(ctx, res.SHA256, res.StorageKey); err != nil {
+		slog.Error("release blob failed", "resource_id", res.ID, "key", res.StorageKey, "err", err)
+	}
+	return nil
+}
+
+// importDir 在前台执行目录导入，Ctrl-C 中断后再次执行同一目录会从中断处继续
+func (a *App) importDir(ctx context.Context, dir, mode string, opts ImportOptions) error {
+	// 进度与 HTTP 上传写入同一个 progressStore，配置了 Redis 时服务端也能查询
+	if err := initProgressStore(); err != nil {
+		return err
+	}
+	j, err := a.openImportJob(dir, mode, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "import job %s (%s, mode %s)\n", j.ID, j.Root, j.Mode)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = a.runImportJob(ctx, j, func(rel, status string, res Resource, err error) {
+		switch {
+		case err != nil:
+			fmt.Printf("%s\t%s\t%v\n", status, rel, err)
+		case res.ID != 0:
+			fmt.Printf("%s\t%s\tresource %d\n", status, rel, res.ID)
+		default:
+			fmt.Printf("%s\t%s\n", status, rel)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %d, skipped %d duplicates, %d failed of %d files\n",
+		j.Imported, j.Skipped, j.Failed, j.TotalFiles)
+	if j.Failed > 0 {
+		return fmt.Errorf("%d files failed, run the same command again to retry them", j.Failed)
+	}
+	return nil
+}
+
+func runGCCommand(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	a, err := openCLI()
+	if err != nil {
+		return err
+	}
+	defer a.db.Close()
+	rep, err := a.collectGarbage(context.Background())
+	if err != nil {
+		return err
+	}
+	return printJSON(rep)
+}
+
+func runReconcileCommand(args []string) error {
+	fs := newFlags("reconcile")
+	dryRun := fs.Bool("dry-run", false, "only report, do not move anything")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	a, err := openCLI()
+	if err != nil {
+		return err
+	}
+	defer a.db.Close()
+	rep, err := a.reconcile(context.Background(), *dryRun)
+	if err != nil {
+		return err
+	}
+	return printJSON(rep)
+}
+
+func runStatsCommand(args []string) error {
+	fs := newFlags("stats")
+	rollup := fs.Bool("rollup", false, "recompute the stats tables first")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	a, err := openCLI()
+	if err != nil {
+		return err
+	}
+	defer a.db.Close()
+	ctx := context.Background()
+	if *rollup {
+		if err := a.rollupStats(); err != nil {
+			return err
+		}
+	}
+	files, size, downloads, err := a.resources.Totals(ctx)
+	if err != nil {
+		return err
+	}
+	users, err := a.users.Count(ctx)
+	if err != nil {
+		return err
+	}
+	return printJSON(map[string]interface{}{
+		"files": files, "users": users, "downloads": downloads, "size": size,
+	})
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func runHelp(args []string) error {
+	fmt.Print(usage)
+	return nil
+}
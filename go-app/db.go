@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "modernc.org/sqlite"
+)
+
+// openApp 按 DB_DRIVER（mysql|sqlite）连接数据库并创建 App。
+// sqlite 使用纯 Go 驱动，不依赖 docker-compose，适合本地开发和进程内测试。
+func openApp() (*App, error) {
+	driver := getEnv("DB_DRIVER", "mysql")
+	var conn *sql.DB
+	var err error
+	switch driver {
+	case "mysql":
+		conn, err = openMySQL()
+	case "sqlite":
+		conn, err = openSQLite(getEnv("SQLITE_PATH", "./data/resapp.db"))
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q", driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newApp(conn, driver), nil
+}
+
+// newApp 在已打开的连接上创建对应驱动的仓储
+func newApp(conn *sql.DB, driver string) *App {
+	a := &App{db: conn, driver: driver}
+	if driver == "sqlite" {
+		a.users = &sqliteUserRepo{mysqlUserRepo{conn}}
+		a.resources = &sqliteResourceRepo{mysqlResourceRepo{conn}}
+		a.announcements = &sqliteAnnouncementRepo{mysqlAnnouncementRepo{conn}}
+	} else {
+		a.users = &mysqlUserRepo{conn}
+		a.resources = &mysqlResourceRepo{conn}
+		a.announcements = &mysqlAnnouncementRepo{conn}
+	}
+	return a
+}
+
+func openMySQL() (*sql.DB, error) {
+	dbHost := getEnv("DB_HOST", "mysql")
+	dbPort := getEnv("DB_PORT", "3306")
+	dbUser := getEnv("DB_USER", "root")
+	dbPassword := getEnv("DB_PASSWORD", "5210")
+	dbName := getEnv("DB_NAME", "resource_share")
+
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&clientFoundRows=true&charset=utf8mb4&collation=utf8mb4_unicode_ci",
+		dbUser, dbPassword, dbHost, dbPort, dbName)
+	conn, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ping mysql %s:%s: %w", dbHost, dbPort, err)
+	}
+	slog.Info("database connected", "driver", "mysql", "host", dbHost, "name", dbName)
+	return conn, nil
+}
+
+// openSQLite 打开 SQLite 数据库文件。写事务以 BEGIN IMMEDIATE 开始并等待锁，
+// 因此 MySQL 中用 SELECT ... FOR UPDATE 保护的读改写在这里同样是串行的。
+func openSQLite(path string) (*sql.DB, error) {
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+	}
+	dsn := "file:" + path + "?_txlock=immediate&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if path == ":memory:" {
+		// 每个连接都是独立的内存库，只能保留一个
+		conn.SetMaxOpenConns(1)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	slog.Info("database connected", "driver", "sqlite", "path", path)
+	return conn, nil
+}
+
+// forUpdate 返回行锁子句；SQLite 不支持 FOR UPDATE，写事务本身已经串行
+func (a *App) forUpdate() string {
+	if a.driver == "sqlite" {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// onConflictUpdate 返回 INSERT 冲突时转为 UPDATE 的子句，后面接 "col=expr" 列表。
+// key 是冲突的唯一键列，仅 SQLite 需要。
+func (a *App) onConflictUpdate(key string) string {
+	if a.driver == "sqlite" {
+		return " ON CONFLICT(" + key + ") DO UPDATE SET "
+	}
+	return " ON DUPLICATE KEY UPDATE "
+}
+
+// insertedValue 在 onConflictUpdate 的 "col=expr" 中引用本次要插入的值
+func (a *App) insertedValue(col string) string {
+	if a.driver == "sqlite" {
+		return "excluded." + col
+	}
+	return "VALUES(" + col + ")"
+}
+
+// localDate 返回时间列所在的本地日期。SQLite 的 CURRENT_TIMESTAMP 是 UTC，要换算到本地时区，
+// 与 MySQL 按会话时区取 DATE 一致
+func (a *App) localDate(col string) string {
+	if a.driver == "sqlite" {
+		return "date(" + col + ",'localtime')"
+	}
+	return "DATE(" + col + ")"
+}
+
+// dateString 把 DATE 表达式格式化为 YYYY-MM-DD 字符串。SQLite 驱动会把声明为 DATE 的列读成 time.Time，
+// 经 strftime 后才是普通文本
+func (a *App) dateString(expr string) string {
+	if a.driver == "sqlite" {
+		return "strftime('%Y-%m-%d'," + expr + ")"
+	}
+	return "DATE_FORMAT(" + expr + ",'%Y-%m-%d')"
+}
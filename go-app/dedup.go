@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"log/slog"
+)
+
+// hashingReader 在数据流经时计算 SHA-256，上传只需读取一遍
+type hashingReader struct {
+	r io.Reader
+	h hash.Hash
+}
+
+func newHashingReader(r io.Reader) *hashingReader {
+	return &hashingReader{r: r, h: sha256.New()}
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	return n, err
+}
+
+func (hr *hashingReader) Sum() string {
+	return hex.EncodeToString(hr.h.Sum(nil))
+}
+
+// acquireBlob 登记刚写入 key 的内容。摘要已存在时引用计数加一并删除重复的副本，
+// 返回应写入 resources.storage_key 的 key。
+func (a *App) acquireBlob(ctx context.Context, key, digest string, size int64) (string, error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`INSERT INTO blobs (sha256,storage_key,size,ref_count) VALUES (?,?,?,1)`+
+		a.onConflictUpdate("sha256")+"ref_count=ref_count+1", digest, key, size)
+	if err != nil {
+		return "", err
+	}
+	var existing string
+	if err := tx.QueryRow("SELECT storage_key FROM blobs WHERE sha256=?", digest).Scan(&existing); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	if existing != key {
+		storage.Delete(ctx, key)
+	}
+	return existing, nil
+}
+
+// releaseBlob 减少一次引用，最后一个引用释放时才删除存储中的对象。
+// digest 为空表示引入去重前的旧资源，直接删除其 key。
+func (a *App) releaseBlob(ctx context.Context, digest, key string) error {
+	if digest == "" {
+		if key == "" {
+			return nil
+		}
+		return storage.Delete(ctx, key)
+	}
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var refs int
+	var blobKey string
+	err = tx.QueryRow("SELECT ref_count,storage_key FROM blobs WHERE sha256=?"+a.forUpdate(), digest).Scan(&refs, &blobKey)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if refs > 1 {
+		if _, err := tx.Exec("UPDATE blobs SET ref_count=ref_count-1 WHERE sha256=?", digest); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	if _, err := tx.Exec("DELETE FROM blobs WHERE sha256=?", digest); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return storage.Delete(ctx, blobKey)
+}
+
+// backfillDigests 为引入去重之前上传、没有 sha256 的资源补算摘要并登记到 blobs，
+// 返回补算成功的资源数。单个资源失败只记录日志，重复执行会继续处理剩下的资源。
+func (a *App) backfillDigests(ctx context.Context) (int, error) {
+	rows, err := a.db.QueryContext(ctx, `SELECT id,storage_key FROM resources
+		WHERE (sha256 IS NULL OR sha256='') AND storage_key IS NOT NULL ORDER BY id`)
+	if err != nil {
+		return 0, err
+	}
+	type pending struct {
+		id  int
+		key string
+	}
+	var list []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		list = append(list, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, p := range list {
+		err := a.adoptBlob(ctx, p.id, p.key)
+		if errors.Is(err, errDigestAlreadySet) {
+			continue
+		} else if err != nil {
+			slog.Warn("digest backfill failed", "resource_id", p.id, "key", p.key, "err", err)
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+// errDigestAlreadySet 表示资源已由并发执行的另一个 reindex 处理，或已被删除
+var errDigestAlreadySet = errors.New("resource digest already set")
+
+// adoptBlob 读取资源现有的对象计算摘要，与 acquireBlob 一样登记引用；
+// 内容已存在时资源改为指向已有对象，并删除自己的副本。
+func (a *App) adoptBlob(ctx context.Context, id int, key string) error {
+	body, err := storage.Get(ctx, key, 0, -1)
+	if err != nil {
+		return err
+	}
+	hr := newHashingReader(body)
+	size, err := io.Copy(io.Discard, hr)
+	body.Close()
+	if err != nil {
+		return err
+	}
+	digest := hr.Sum()
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`INSERT INTO blobs (sha256,storage_key,size,ref_count) VALUES (?,?,?,1)`+
+		a.onConflictUpdate("sha256")+"ref_count=ref_count+1", digest, key, size)
+	if err != nil {
+		return err
+	}
+	var existing string
+	if err := tx.QueryRow("SELECT storage_key FROM blobs WHERE sha256=?", digest).Scan(&existing); err != nil {
+		return err
+	}
+	// 条件更新：并发执行的另一个 reindex 已经处理过这一行时放弃本次登记
+	res, err := tx.Exec(`UPDATE resources SET sha256=?,storage_key=?,name=?,size=?
+		WHERE id=? AND (sha256 IS NULL OR sha256='')`, digest, existing, existing, size, id)
+	if err := affected(res, err); errors.Is(err, ErrNotFound) {
+		return errDigestAlreadySet
+	} else if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if existing != key {
+		return storage.Delete(ctx, key)
+	}
+	return nil
+}
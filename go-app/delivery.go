@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DELIVERY_MODE=accel 时 Go 只负责鉴权、计数和响应头，文件内容由 nginx 通过
+// X-Accel-Redirect 跳转到 internal location 输出；direct 则由 Go 自己读取并输出。
+var (
+	deliveryMode = getEnv("DELIVERY_MODE", "direct")
+	accelPrefix  = getEnv("ACCEL_REDIRECT_PREFIX", "/uploads/")
+)
+
+func initDelivery() error {
+	switch deliveryMode {
+	case "direct":
+	case "accel":
+		if _, ok := storage.(*LocalStorage); !ok {
+			// nginx 只能读取本地目录，对象存储仍由 Go 转发
+			slog.Warn("DELIVERY_MODE=accel requires STORAGE_DRIVER=local, falling back to direct")
+			deliveryMode = "direct"
+		}
+		if !strings.HasPrefix(accelPrefix, "/") || !strings.HasSuffix(accelPrefix, "/") {
+			return fmt.Errorf("ACCEL_REDIRECT_PREFIX must start and end with '/', got %q", accelPrefix)
+		}
+	default:
+		return fmt.Errorf("unknown DELIVERY_MODE %q", deliveryMode)
+	}
+	return nil
+}
+
+// accelRedirect 让 nginx 从 accelPrefix 对应的 internal location 输出对象；
+// Range、Last-Modified 与 Content-Type 都交给 nginx 处理。
+// 实际字节由 nginx 发送，这里按 Range 请求头估算。
+func accelRedirect(w http.ResponseWriter, r *http.Request, key string) (int, int64) {
+	info, err := storage.Stat(r.Context(), key)
+	if err != nil {
+		writeError(w, r, apiResourceNotFound)
+		return 404, 0
+	}
+	w.Header().Set("X-Accel-Redirect", (&url.URL{Path: accelPrefix + key}).EscapedPath())
+	w.WriteHeader(http.StatusOK)
+	return http.StatusOK, rangeBytes(r.Header.Get("Range"), info.Size)
+}
+
+// rangeBytes 计算 Range 请求头覆盖的字节数，无法解析时视为整个文件
+func rangeBytes(header string, size int64) int64 {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return size
+	}
+	var total int64
+	for _, part := range strings.Split(spec, ",") {
+		start, end, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return size
+		}
+		if start == "" {
+			n, err := strconv.ParseInt(end, 10, 64)
+			if err != nil {
+				return size
+			}
+			total += min(n, size)
+			continue
+		}
+		first, err := strconv.ParseInt(start, 10, 64)
+		if err != nil || first >= size {
+			continue
+		}
+		last := size - 1
+		if end != "" {
+			if l, err := strconv.ParseInt(end, 10, 64); err == nil && l < last {
+				last = l
+			}
+		}
+		if last >= first {
+			total += last - first + 1
+		}
+	}
+	return total
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 同一客户端在该时间窗口内重复下载同一资源只计一次
+var downloadCountWindow = getEnvDuration("DOWNLOAD_COUNT_WINDOW", 24*time.Hour)
+
+// isRangeContinuation 判断是否为断点续传/分段下载的后续请求：每个区间都有明确且大于 0 的起点。
+// 从 0 开始的 Range 和 bytes=-N 这样的后缀区间（可以取得整个文件）都视为一次新的下载
+func isRangeContinuation(r *http.Request) bool {
+	spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok {
+		return false
+	}
+	for _, rng := range strings.Split(spec, ",") {
+		start, _, _ := strings.Cut(rng, "-")
+		n, err := strconv.ParseInt(strings.TrimSpace(start), 10, 64)
+		if err != nil || n <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// downloadClientKey 标识下载者：登录用户按用户 ID，匿名访问按 IP + User-Agent
+func downloadClientKey(r *http.Request) string {
+	if uid := principalFromRequest(r).UserID; uid != 0 {
+		return "u:" + strconv.Itoa(uid)
+	}
+	h := sha256.Sum256([]byte(clientIP(r) + "|" + r.UserAgent()))
+	return "a:" + hex.EncodeToString(h[:16])
+}
+
+// recordDownload 写入一条 download_events 记录，并在需要计数时同步累加 resources.downloads
+func (a *App) recordDownload(r *http.Request, resourceID string, status int, bytes int64) {
+	downloadBytes.Add(float64(bytes))
+	if r.Method == "HEAD" || (status != http.StatusOK && status != http.StatusPartialContent) {
+		return
+	}
+	clientKey := downloadClientKey(r)
+	var userID interface{}
+	if uid := principalFromRequest(r).UserID; uid != 0 {
+		userID = uid
+	}
+	ua, rng := r.UserAgent(), r.Header.Get("Range")
+	if len(ua) > 255 {
+		ua = ua[:255]
+	}
+	if len(rng) > 128 {
+		rng = rng[:128]
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		reqLogger(r).Error("record download failed", "err", err)
+		return
+	}
+	defer tx.Rollback()
+
+	counted := false
+	if !isRangeContinuation(r) {
+		// 锁住资源行，同一资源的并发请求依次判断窗口，避免同一客户端被重复计数
+		// （SQLite 的事务以 IMMEDIATE 开始，本身已串行）
+		var id int
+		err := tx.QueryRow("SELECT id FROM resources WHERE id=?"+a.forUpdate(), resourceID).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return
+		} else if err != nil {
+			reqLogger(r).Error("record download failed", "err", err)
+			return
+		}
+		var n int
+		err = tx.QueryRow(`SELECT COUNT(*) FROM download_events
+			WHERE resource_id=? AND client_key=? AND counted=1 AND created_at>?`,
+			resourceID, clientKey, time.Now().Add(-downloadCountWindow)).Scan(&n)
+		if err != nil {
+			reqLogger(r).Error("record download failed", "err", err)
+			return
+		}
+		counted = n == 0
+	}
+	_, err = tx.Exec(`INSERT INTO download_events (resource_id,user_id,client_key,ip,user_agent,range_header,bytes,counted)
+		VALUES (?,?,?,?,?,?,?,?)`, resourceID, userID, clientKey, clientIP(r), ua, rng, bytes, counted)
+	if err != nil {
+		reqLogger(r).Error("record download failed", "err", err)
+		return
+	}
+	if counted {
+		if _, err := tx.Exec("UPDATE resources SET downloads=downloads+1 WHERE id=?", resourceID); err != nil {
+			reqLogger(r).Error("record download failed", "err", err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		reqLogger(r).Error("record download failed", "err", err)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/text/language"
+)
+
+// APIError 是接口返回的统一错误。Code 是稳定的机器可读代码，客户端应据此判断；
+// 消息按 Accept-Language 在中文与英文之间选择，默认中文。
+type APIError struct {
+	Status int
+	Code   string
+	zh, en string
+	args   []interface{}
+	cause  error
+}
+
+func newAPIError(status int, code, zh, en string) *APIError {
+	return &APIError{Status: status, Code: code, zh: zh, en: en}
+}
+
+func (e *APIError) Error() string {
+	if e.cause != nil {
+		return e.Code + ": " + e.cause.Error()
+	}
+	return e.Code
+}
+
+func (e *APIError) Unwrap() error { return e.cause }
+
+// With 返回填入消息参数的副本，消息模板使用 fmt 格式
+func (e *APIError) With(args ...interface{}) *APIError {
+	c := *e
+	c.args = args
+	return &c
+}
+
+// Wrap 返回附带内部原因的副本；原因只写入日志，不返回给客户端
+func (e *APIError) Wrap(err error) *APIError {
+	c := *e
+	c.cause = err
+	return &c
+}
+
+func (e *APIError) Message(lang language.Tag) string {
+	msg := e.zh
+	if lang == language.English {
+		msg = e.en
+	}
+	if len(e.args) > 0 {
+		msg = fmt.Sprintf(msg, e.args...)
+	}
+	return msg
+}
+
+var langMatcher = language.NewMatcher([]language.Tag{language.SimplifiedChinese, language.English})
+
+func requestLang(r *http.Request) language.Tag {
+	tags, _, _ := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if len(tags) == 0 {
+		return language.SimplifiedChinese
+	}
+	_, i, c := langMatcher.Match(tags...)
+	if i == 1 && c != language.No {
+		return language.English
+	}
+	return language.SimplifiedChinese
+}
+
+// writeError 以 {"error","code","request_id"} 输出错误。数据访问层的 ErrNotFound/ErrConflict
+// 映射为 404/409，其余非 APIError 的错误按内部错误处理；原因是数据库不可用的 5xx 一律改为 503。
+// 5xx 的原因会连同 request_id 写入日志。
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var e *APIError
+	if !errors.As(err, &e) {
+		switch {
+		case errors.Is(err, ErrNotFound):
+			e = apiRecordNotFound.Wrap(err)
+		case errors.Is(err, ErrConflict):
+			e = apiConflict.Wrap(err)
+		default:
+			e = apiInternal.Wrap(err)
+		}
+	}
+	if e.Status >= 500 && errors.Is(dbError(err), ErrUnavailable) {
+		e = apiUnavailable.Wrap(err)
+	}
+	if e.Status >= 500 {
+		reqLogger(r).Error("request failed", "code", e.Code, "err", err)
+	}
+	if e.Status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "5")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":      e.Message(requestLang(r)),
+		"code":       e.Code,
+		"request_id": w.Header().Get("X-Request-ID"),
+	})
+}
+
+// handleNotFound 兜底处理未注册的 /api/ 路径，避免返回纯文本 404
+func handleNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, apiNotFound)
+}
+
+var (
+	apiInternal         = newAPIError(500, "INTERNAL_ERROR", "服务器内部错误", "Internal server error")
+	apiDatabase         = newAPIError(500, "DATABASE_ERROR", "数据库操作失败", "Database operation failed")
+	apiStorage          = newAPIError(500, "STORAGE_ERROR", "文件存储操作失败", "File storage operation failed")
+	apiMethodNotAllowed = newAPIError(405, "METHOD_NOT_ALLOWED", "不支持的请求方法", "Method not allowed")
+	apiNotFound         = newAPIError(404, "NOT_FOUND", "接口不存在", "Not found")
+	apiBadRequest       = newAPIError(400, "BAD_REQUEST", "请求格式错误", "Malformed request body")
+	apiRecordNotFound   = newAPIError(404, "RECORD_NOT_FOUND", "记录不存在", "Record not found")
+	apiConflict         = newAPIError(409, "CONFLICT", "数据冲突，请刷新后重试", "The request conflicts with existing data")
+	apiUnavailable      = newAPIError(503, "SERVICE_UNAVAILABLE", "服务暂时不可用，请稍后重试", "Service temporarily unavailable, please retry later")
+
+	// 认证与账号
+	apiUnauthorized       = newAPIError(401, "UNAUTHORIZED", "请先登录", "Authentication required")
+	apiInvalidToken       = newAPIError(401, "INVALID_TOKEN", "登录凭证无效或已过期", "Invalid or expired token")
+	apiTokenRevoked       = newAPIError(401, "TOKEN_REVOKED", "登录凭证已失效，请重新登录", "Token has been revoked")
+	apiInvalidAPIKey      = newAPIError(401, "INVALID_API_KEY", "API 密钥无效", "Invalid API key")
+	apiInsufficientScope  = newAPIError(403, "INSUFFICIENT_SCOPE", "API 密钥权限不足", "API key scope does not allow this request")
+	apiAdminRequired      = newAPIError(403, "ADMIN_REQUIRED", "需要管理员权限", "Administrator privileges required")
+	apiInvalidCredentials = newAPIError(401, "INVALID_CREDENTIALS", "用户名或密码错误", "Incorrect username or password")
+	apiInvalidSignup      = newAPIError(400, "INVALID_SIGNUP", "用户名至少3位，密码至少6位", "Username must be at least 3 characters and password at least 6")
+	apiPasswordTooLong    = newAPIError(400, "PASSWORD_TOO_LONG", "密码不能超过72字节", "Password must not exceed 72 bytes")
+	apiUsernameTaken      = newAPIError(409, "USERNAME_TAKEN", "用户名已存在", "Username already exists")
+	apiUserNotFound       = newAPIError(404, "USER_NOT_FOUND", "用户不存在", "User not found")
+	apiInvalidRole        = newAPIError(400, "INVALID_ROLE", "角色只能是 user 或 admin", "Role must be user or admin")
+	apiProtectedUser      = newAPIError(403, "PROTECTED_USER", "不能删除或降级最后一个管理员", "The last administrator cannot be deleted or demoted")
+
+	// 刷新令牌
+	apiRefreshRequired = newAPIError(400, "REFRESH_TOKEN_REQUIRED", "缺少 refresh_token", "refresh_token is required")
+	apiInvalidRefresh  = newAPIError(401, "INVALID_REFRESH_TOKEN", "刷新令牌无效", "Invalid refresh token")
+	apiRefreshReused   = newAPIError(401, "REFRESH_TOKEN_REUSED", "刷新令牌被重复使用，请重新登录", "Refresh token reuse detected")
+	apiRefreshExpired  = newAPIError(401, "REFRESH_TOKEN_EXPIRED", "刷新令牌已过期", "Refresh token expired")
+
+	// API 密钥
+	apiKeyNotAllowed      = newAPIError(403, "API_KEY_NOT_ALLOWED", "API 密钥不能用于管理 API 密钥", "API keys cannot manage API keys")
+	apiKeyNotFound        = newAPIError(404, "API_KEY_NOT_FOUND", "密钥不存在", "API key not found")
+	apiKeyInvalidName     = newAPIError(400, "INVALID_API_KEY_NAME", "名称不能为空且不超过100个字符", "Name is required and must not exceed 100 characters")
+	apiScopeRequired      = newAPIError(400, "SCOPE_REQUIRED", "至少需要一个 scope", "At least one scope is required")
+	apiInvalidScope       = newAPIError(400, "INVALID_SCOPE", "无效的 scope: %s", "Invalid scope: %s")
+	apiAdminScopeDenied   = newAPIError(403, "ADMIN_SCOPE_FORBIDDEN", "只有管理员可以创建 admin scope 的密钥", "Only administrators can create keys with the admin scope")
+	apiKeyInvalidLifetime = newAPIError(400, "INVALID_EXPIRY", "有效期需在0到3650天之间", "Expiry must be between 0 and 3650 days")
+
+	// 资源与下载
+	apiResourceNotFound   = newAPIError(404, "RESOURCE_NOT_FOUND", "资源不存在", "Resource not found")
+	apiResourceForbidden  = newAPIError(403, "RESOURCE_FORBIDDEN", "无权操作该资源", "You are not allowed to modify this resource")
+	apiAccessDenied       = newAPIError(403, "ACCESS_DENIED", "无权访问该资源", "You are not allowed to access this resource")
+	apiInvalidVisibility  = newAPIError(400, "INVALID_VISIBILITY", "visibility 只能是 public、private 或 unlisted", "visibility must be public, private or unlisted")
+	apiPreviewUnsupported = newAPIError(400, "PREVIEW_UNSUPPORTED", "该文件类型不支持预览", "Preview is not supported for this file type")
+	apiLinkExpired        = newAPIError(410, "LINK_EXPIRED", "链接已过期", "Link has expired")
+	apiLinkExhausted      = newAPIError(410, "LINK_EXHAUSTED", "链接使用次数已用完", "Link usage limit reached")
+	apiInvalidLinkParams  = newAPIError(400, "INVALID_LINK_PARAMS", "有效期最长7天，使用次数不能为负", "Expiry must not exceed 7 days and max_uses must not be negative")
+
+	// 上传
+	apiUploadIDRequired  = newAPIError(400, "UPLOAD_ID_REQUIRED", "缺少上传 ID", "Upload ID is required")
+	apiUploadNotFound    = newAPIError(404, "UPLOAD_NOT_FOUND", "上传任务不存在", "Upload not found")
+	apiUploadForbidden   = newAPIError(403, "UPLOAD_FORBIDDEN", "无权访问该上传任务", "You are not allowed to access this upload")
+	apiFileTooLarge      = newAPIError(413, "FILE_TOO_LARGE", "文件大小超过7GB限制", "File exceeds the 7GB size limit")
+	apiInvalidUpload     = newAPIError(400, "INVALID_UPLOAD", "读取文件失败", "Could not read the uploaded file")
+	apiInvalidUploadInit = newAPIError(400, "INVALID_UPLOAD_PARAMS", "文件名和文件大小不能为空", "file_name and file_size are required")
+	apiInvalidChunkSize  = newAPIError(400, "INVALID_CHUNK_SIZE", "分块大小需在1MB到100MB之间", "chunk_size must be between 1MB and 100MB")
+	apiInvalidChunkIndex = newAPIError(400, "INVALID_CHUNK_INDEX", "分块序号无效", "Invalid chunk index")
+	apiChunkSizeMismatch = newAPIError(400, "CHUNK_SIZE_MISMATCH", "分块大小不匹配，期望 %d 字节", "Chunk size mismatch, expected %d bytes")
+	apiUploadFinished    = newAPIError(409, "UPLOAD_FINISHED", "上传任务已结束", "Upload is no longer in progress")
+	apiUploadCancelled   = newAPIError(409, "UPLOAD_CANCELLED", "上传任务已取消", "Upload was cancelled")
+	apiUploadMerging     = newAPIError(409, "UPLOAD_MERGING", "分块正在合并，请稍后查询结果", "Chunks are being merged, check the upload status later")
+	apiUploadCompleted   = newAPIError(409, "UPLOAD_COMPLETED", "上传任务已完成", "Upload is already completed")
+	apiChunksIncomplete  = newAPIError(409, "CHUNKS_INCOMPLETE", "分块未全部上传 (%d/%d)", "Not all chunks have been uploaded (%d/%d)")
+	apiStreamUnsupported = newAPIError(500, "STREAMING_UNSUPPORTED", "服务器不支持流式响应", "Streaming is not supported")
+
+	// 分享链接
+	apiShareNotFound    = newAPIError(404, "SHARE_NOT_FOUND", "分享链接不存在", "Share link not found")
+	apiShareRevoked     = newAPIError(410, "SHARE_REVOKED", "分享链接已失效", "Share link has been revoked")
+	apiShareExpired     = newAPIError(410, "SHARE_EXPIRED", "分享链接已过期", "Share link has expired")
+	apiShareExhausted   = newAPIError(410, "SHARE_EXHAUSTED", "分享链接下载次数已用完", "Share link download limit reached")
+	apiSharePassword    = newAPIError(401, "SHARE_PASSWORD_INVALID", "分享密码错误", "Incorrect share password")
+	apiShareForbidden   = newAPIError(403, "SHARE_FORBIDDEN", "无权操作该分享链接", "You are not allowed to manage this share link")
+	apiInvalidShareArgs = newAPIError(400, "INVALID_SHARE_PARAMS", "有效期和下载次数不能为负", "expires_in and max_downloads must not be negative")
+	apiSharePreviewOff  = newAPIError(403, "SHARE_PREVIEW_DISABLED", "限制下载次数的分享链接不支持预览", "Preview is not available for share links with a download limit")
+
+	// 公告
+	apiAnnouncementNotFound = newAPIError(404, "ANNOUNCEMENT_NOT_FOUND", "公告不存在", "Announcement not found")
+
+	// 统计
+	apiInvalidDateRange = newAPIError(400, "INVALID_DATE_RANGE", "日期范围无效，格式为 YYYY-MM-DD", "Invalid date range, expected YYYY-MM-DD")
+	apiInvalidMetric    = newAPIError(400, "INVALID_METRIC", "metric 取 downloads|uploads|bytes，interval 取 day|week", "metric must be downloads|uploads|bytes and interval day|week")
+
+	// 目录导入
+	apiImportNotFound    = newAPIError(404, "IMPORT_NOT_FOUND", "导入任务不存在", "Import job not found")
+	apiInvalidImportPath = newAPIError(400, "INVALID_IMPORT_PATH", "导入路径必须是 IMPORT_ROOT 下的目录", "path must be a directory under IMPORT_ROOT")
+	apiInvalidImportMode = newAPIError(400, "INVALID_IMPORT_MODE", "mode 只能是 copy 或 link，link 仅支持本地存储", "mode must be copy or link, and link requires local storage")
+	apiImportRunning     = newAPIError(409, "IMPORT_RUNNING", "导入任务正在运行", "Import job is already running")
+
+	// 对账
+	apiReconcileRunning = newAPIError(409, "RECONCILE_RUNNING", "对账任务正在运行", "Reconciliation is already running")
+)
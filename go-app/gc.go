@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 超过 CHUNK_UPLOAD_TTL 没有新分块的未完成上传视为放弃，在此之前客户端都可以续传
+var chunkUploadTTL = getEnvDuration("CHUNK_UPLOAD_TTL", 24*time.Hour)
+
+type gcReport struct {
+	RefreshTokens int64 `json:"refresh_tokens"`
+	DownloadLinks int64 `json:"download_links"`
+	UploadTasks   int   `json:"upload_tasks"`
+}
+
+// collectGarbage 删除已过期的刷新令牌和签名下载链接记录，以及放弃的分块上传任务和它们的分块文件
+func (a *App) collectGarbage(ctx context.Context) (gcReport, error) {
+	var rep gcReport
+	now := time.Now()
+	res, err := a.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE expires_at<?", now)
+	if err != nil {
+		return rep, dbError(err)
+	}
+	rep.RefreshTokens, _ = res.RowsAffected()
+	res, err = a.db.ExecContext(ctx, "DELETE FROM download_links WHERE expires_at<?", now)
+	if err != nil {
+		return rep, dbError(err)
+	}
+	rep.DownloadLinks, _ = res.RowsAffected()
+
+	rows, err := a.db.QueryContext(ctx, `SELECT id FROM upload_tasks
+		WHERE status<>'completed' AND COALESCE(updated_at,created_at,0)<?`, now.Add(-chunkUploadTTL).Unix())
+	if err != nil {
+		return rep, dbError(err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return rep, dbError(err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return rep, dbError(err)
+	}
+	for _, id := range ids {
+		// 先删分块再删记录，分块删除失败时任务仍会被下一次 gc 找到
+		if err := os.RemoveAll(filepath.Join(chunkDir, id)); err != nil {
+			return rep, err
+		}
+		if _, err := a.db.ExecContext(ctx, "DELETE FROM upload_tasks WHERE id=? AND status<>'completed'", id); err != nil {
+			return rep, dbError(err)
+		}
+		chunkLocks.Delete(id)
+		rep.UploadTasks++
+	}
+	return rep, nil
+}
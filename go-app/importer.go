@@ -0,0 +1,654 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// API 发起的目录导入只能读取 IMPORT_ROOT 下的目录；命令行导入不受此限制
+var importRoot = getEnv("IMPORT_ROOT", "./imports")
+
+// 与文件同名、追加此后缀的文本文件作为该文件的描述，本身不会被导入
+const descSidecarExt = ".desc"
+
+// 执行者认领任务后每 importHeartbeat 刷新一次心跳；超过 importClaimTTL 没有心跳的
+// running 任务视为执行者已退出，命令行和任意服务实例都可以接手
+const (
+	importHeartbeat = 30 * time.Second
+	importClaimTTL  = 4 * importHeartbeat
+)
+
+var errImportClaimLost = errors.New("import job was claimed by another runner")
+
+// ImportOptions 是从本地文件导入资源时的附加信息
+type ImportOptions struct {
+	Description string
+	Visibility  string
+	UploaderID  int
+}
+
+// importFile 把本地文件写入存储并登记为资源，流程与 handleUpload 相同：
+// 计算 SHA-256、按摘要去重、按扩展名分类。
+func (a *App) importFile(ctx context.Context, path string, opts ImportOptions) (Resource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Resource{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return Resource{}, err
+	}
+	if !fi.Mode().IsRegular() {
+		return Resource{}, fmt.Errorf("%s is not a regular file", path)
+	}
+	if opts.Visibility != "" && !validVisibility[opts.Visibility] {
+		return Resource{}, fmt.Errorf("invalid visibility %q", opts.Visibility)
+	}
+
+	origName := filepath.Base(path)
+	newName := uuid.New().String() + filepath.Ext(origName)
+	written, digest, err := streamToStorage(ctx, newName, f, nil)
+	if err != nil {
+		storage.Delete(ctx, newName)
+		if errors.Is(err, errUploadTooLarge) {
+			return Resource{}, fmt.Errorf("%s exceeds the 7GB upload limit", path)
+		}
+		return Resource{}, err
+	}
+	return a.registerImport(ctx, newName, digest, written, origName, opts)
+}
+
+// registerImport 登记已写入存储的对象并创建资源记录，失败时释放对象
+func (a *App) registerImport(ctx context.Context, newName, digest string, size int64, origName string, opts ImportOptions) (Resource, error) {
+	key, err := a.acquireBlob(ctx, newName, digest, size)
+	if err != nil {
+		storage.Delete(ctx, newName)
+		return Resource{}, err
+	}
+	ft := getFileType(filepath.Ext(origName))
+	res := Resource{
+		OrigName: origName, Size: size, Category: getCategoryFromFileType(ft),
+		Description: opts.Description, StorageKey: key, SHA256: digest, FileType: ft,
+		UploaderID: opts.UploaderID, Visibility: opts.Visibility,
+	}
+	id, err := a.resources.Create(ctx, &res)
+	if err != nil {
+		a.releaseBlob(ctx, digest, key)
+		return Resource{}, err
+	}
+	res.ID = int(id)
+	return res, nil
+}
+
+// ImportJob 是一次目录导入。每个文件的结果写入 import_items，重新运行同一任务时
+// 跳过已导入或已判定为重复的文件，只重试失败的和尚未处理的。
+type ImportJob struct {
+	ID          string `json:"id"`
+	Root        string `json:"root"`
+	Mode        string `json:"mode"`
+	Visibility  string `json:"visibility"`
+	Description string `json:"description"`
+	UploaderID  int    `json:"uploader_id"`
+	Status      string `json:"status"`
+	TotalFiles  int    `json:"total_files"`
+	TotalBytes  int64  `json:"total_bytes"`
+	Imported    int    `json:"imported"`
+	Skipped     int    `json:"skipped"`
+	Failed      int    `json:"failed"`
+	Error       string `json:"error,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+
+	owner string // 本进程认领任务时写入 import_jobs.owner 的标识
+}
+
+const importJobColumns = `id,root,mode,visibility,COALESCE(description,''),COALESCE(uploader_id,0),status,
+	total_files,total_bytes,imported,skipped,failed,COALESCE(error,''),created_at,updated_at`
+
+func scanImportJob(row rowScanner) (*ImportJob, error) {
+	var j ImportJob
+	err := row.Scan(&j.ID, &j.Root, &j.Mode, &j.Visibility, &j.Description, &j.UploaderID, &j.Status,
+		&j.TotalFiles, &j.TotalBytes, &j.Imported, &j.Skipped, &j.Failed, &j.Error, &j.CreatedAt, &j.UpdatedAt)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return &j, nil
+}
+
+func (a *App) getImportJob(id string) (*ImportJob, error) {
+	return scanImportJob(a.db.QueryRow("SELECT "+importJobColumns+" FROM import_jobs WHERE id=?", id))
+}
+
+// openImportJob 返回同一目录下最近一个未完成的任务以便续传，没有时新建任务。
+// 续传时沿用原任务的 mode 等参数。
+func (a *App) openImportJob(root, mode string, opts ImportOptions) (*ImportJob, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(root); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	if mode != "copy" && mode != "link" {
+		return nil, fmt.Errorf("invalid import mode %q", mode)
+	}
+	if _, ok := storage.(*LocalStorage); mode == "link" && !ok {
+		return nil, errors.New("link mode requires STORAGE_DRIVER=local")
+	}
+
+	j, err := scanImportJob(a.db.QueryRow("SELECT "+importJobColumns+
+		" FROM import_jobs WHERE root=? AND status<>'completed' ORDER BY created_at DESC LIMIT 1", root))
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		return j, err
+	}
+	if opts.Visibility == "" {
+		opts.Visibility = "public"
+	}
+	now := time.Now().Unix()
+	j = &ImportJob{
+		ID: uuid.New().String(), Root: root, Mode: mode, Visibility: opts.Visibility,
+		Description: opts.Description, UploaderID: opts.UploaderID, Status: "running",
+		CreatedAt: now, UpdatedAt: now,
+	}
+	var uploader interface{}
+	if opts.UploaderID != 0 {
+		uploader = opts.UploaderID
+	}
+	_, err = a.db.Exec(`INSERT INTO import_jobs (id,root,mode,visibility,description,uploader_id,status,created_at,updated_at)
+		VALUES (?,?,?,?,?,?,?,?,?)`, j.ID, j.Root, j.Mode, j.Visibility, j.Description, uploader, j.Status, now, now)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return j, nil
+}
+
+type importEntry struct {
+	rel  string // 相对 root 的路径，使用 / 分隔
+	size int64
+}
+
+// scanImportTree 列出 root 下待导入的普通文件。隐藏文件和目录、符号链接、.desc 说明文件不导入；
+// 无法读取的子目录记录日志后跳过。
+func scanImportTree(root string) ([]importEntry, int64, error) {
+	var entries []importEntry
+	var total int64
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			slog.Warn("import: skipping unreadable path", "path", p, "err", err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if p != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(d.Name(), descSidecarExt) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, importEntry{filepath.ToSlash(rel), info.Size()})
+		total += info.Size()
+		return nil
+	})
+	return entries, total, err
+}
+
+// importDescription 依次取同名 .desc 说明文件的内容、所在子目录的路径、任务的默认描述
+func importDescription(j *ImportJob, rel string) string {
+	if d := readDescSidecar(filepath.Join(j.Root, filepath.FromSlash(rel)) + descSidecarExt); d != "" {
+		return d
+	}
+	if dir := path.Dir(rel); dir != "." {
+		return strings.ReplaceAll(dir, "/", " / ")
+	}
+	return j.Description
+}
+
+// readDescSidecar 读取说明文件，与扫描时一样只接受普通文件：符号链接可能指向导入目录以外，
+// FIFO 等特殊文件会让读取阻塞。打开后再比对一次，防止 Lstat 之后被替换成链接。
+func readDescSidecar(p string) string {
+	lfi, err := os.Lstat(p)
+	if err != nil || !lfi.Mode().IsRegular() {
+		return ""
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err != nil || !os.SameFile(lfi, fi) {
+		return ""
+	}
+	b, _ := io.ReadAll(io.LimitReader(f, 64<<10))
+	return strings.TrimSpace(string(b))
+}
+
+func (a *App) blobExists(ctx context.Context, digest string) (bool, error) {
+	var n int
+	err := a.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM blobs WHERE sha256=?", digest).Scan(&n)
+	return n > 0, dbError(err)
+}
+
+// importTreeFile 导入目录中的一个文件。copy 模式边复制边计算摘要，内容重复时删除副本；
+// link 模式先读一遍计算摘要，不重复时再在 uploadDir 中创建硬链接，不额外占用空间，
+// 但之后修改源文件也会改变已导入的资源。skipped 为 true 表示内容已存在。
+func (a *App) importTreeFile(ctx context.Context, j *ImportJob, e importEntry, onProgress func(int64)) (res Resource, skipped bool, err error) {
+	if e.size > maxUploadSize {
+		return res, false, errUploadTooLarge
+	}
+	src := filepath.Join(j.Root, filepath.FromSlash(e.rel))
+	f, err := os.Open(src)
+	if err != nil {
+		return res, false, err
+	}
+	defer f.Close()
+
+	origName := path.Base(e.rel)
+	newName := uuid.New().String() + filepath.Ext(origName)
+	pr := &ProgressReader{Reader: f, OnProgress: onProgress}
+	var size int64
+	var digest string
+	if j.Mode == "link" {
+		hr := newHashingReader(&sizeGuard{Reader: pr, limit: maxUploadSize})
+		if size, err = io.Copy(io.Discard, hr); err != nil {
+			return res, false, err
+		}
+		digest = hr.Sum()
+	} else {
+		if size, digest, err = streamToStorage(ctx, newName, pr, nil); err != nil {
+			storage.Delete(ctx, newName)
+			return res, false, err
+		}
+	}
+
+	dup, err := a.blobExists(ctx, digest)
+	if err != nil || dup {
+		if j.Mode != "link" {
+			storage.Delete(ctx, newName)
+		}
+		return res, dup, err
+	}
+	if j.Mode == "link" {
+		ls, ok := storage.(*LocalStorage)
+		if !ok {
+			return res, false, errors.New("link mode requires STORAGE_DRIVER=local")
+		}
+		dst, err := ls.path(newName)
+		if err != nil {
+			return res, false, err
+		}
+		if err := os.Link(src, dst); err != nil {
+			return res, false, err
+		}
+	}
+	res, err = a.registerImport(ctx, newName, digest, size, origName, ImportOptions{
+		Description: importDescription(j, e.rel), Visibility: j.Visibility, UploaderID: j.UploaderID,
+	})
+	return res, false, err
+}
+
+func pathHash(rel string) string {
+	sum := sha256.Sum256([]byte(rel))
+	return hex.EncodeToString(sum[:])
+}
+
+// importItems 读取任务中已经处理过的文件及其结果
+func (a *App) importItems(jobID string) (map[string]string, error) {
+	rows, err := a.db.Query("SELECT path,status FROM import_items WHERE job_id=?", jobID)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+	items := map[string]string{}
+	for rows.Next() {
+		var p, status string
+		if err := rows.Scan(&p, &status); err != nil {
+			return nil, dbError(err)
+		}
+		items[p] = status
+	}
+	return items, dbError(rows.Err())
+}
+
+func (a *App) saveImportItem(jobID, rel, status string, resourceID int, itemErr error) error {
+	var rid interface{}
+	if resourceID != 0 {
+		rid = resourceID
+	}
+	var msg interface{}
+	if itemErr != nil {
+		msg = itemErr.Error()
+	}
+	_, err := a.db.Exec(`INSERT INTO import_items (job_id,path_hash,path,status,resource_id,error,updated_at)
+		VALUES (?,?,?,?,?,?,?)`+a.onConflictUpdate("job_id,path_hash")+
+		"status=?,resource_id=?,error=?,updated_at=?",
+		jobID, pathHash(rel), rel, status, rid, msg, time.Now().Unix(), status, rid, msg, time.Now().Unix())
+	return dbError(err)
+}
+
+// saveImportJob 写回任务进度并刷新心跳。任务已被其他执行者接手时返回 errImportClaimLost，
+// 本进程应停止处理。
+func (a *App) saveImportJob(j *ImportJob) error {
+	j.UpdatedAt = time.Now().Unix()
+	err := affected(a.db.Exec(`UPDATE import_jobs SET status=?,total_files=?,total_bytes=?,imported=?,skipped=?,failed=?,
+		error=?,updated_at=?,heartbeat=? WHERE id=? AND owner=?`, j.Status, j.TotalFiles, j.TotalBytes, j.Imported,
+		j.Skipped, j.Failed, j.Error, j.UpdatedAt, j.UpdatedAt, j.ID, j.owner))
+	if errors.Is(err, ErrNotFound) {
+		return errImportClaimLost
+	}
+	return err
+}
+
+// claimImportJob 在数据库中认领任务：只有不在运行、或运行者心跳已超时的任务才能认领成功。
+// 同一目录的命令行导入和 API 导入因此不会同时执行同一个任务。
+func (a *App) claimImportJob(j *ImportJob) error {
+	owner := uuid.New().String()
+	now := time.Now().Unix()
+	err := affected(a.db.Exec(`UPDATE import_jobs SET status='running',owner=?,heartbeat=?,updated_at=?
+		WHERE id=? AND (status<>'running' OR heartbeat<?)`, owner, now, now, j.ID, now-int64(importClaimTTL.Seconds())))
+	if errors.Is(err, ErrNotFound) {
+		return apiImportRunning
+	} else if err != nil {
+		return err
+	}
+	j.owner, j.Status, j.UpdatedAt = owner, "running", now
+	return nil
+}
+
+// keepImportClaim 在任务执行期间定期刷新心跳，单个大文件耗时较长时任务也不会被其他进程接手
+func (a *App) keepImportClaim(j *ImportJob) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(importHeartbeat)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if _, err := a.db.Exec("UPDATE import_jobs SET heartbeat=? WHERE id=? AND owner=?",
+					time.Now().Unix(), j.ID, j.owner); err != nil {
+					slog.Warn("import: heartbeat failed", "job_id", j.ID, "err", err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// runImportJob 认领并执行（或续传）导入任务，进度以任务 ID 写入 progressStore，
+// 可以像上传一样通过 /api/upload/progress/{id} 查询。onItem 在每个文件处理完后调用，可以为 nil。
+// 单个文件失败只计入 failed，数据库不可用等错误会中止任务并返回。
+func (a *App) runImportJob(ctx context.Context, j *ImportJob, onItem func(rel, status string, res Resource, err error)) error {
+	if err := a.claimImportJob(j); err != nil {
+		return err
+	}
+	return a.executeImportJob(ctx, j, onItem)
+}
+
+// startImportJob 认领任务后在后台执行，请求结束不影响任务
+func (a *App) startImportJob(j *ImportJob) error {
+	if err := a.claimImportJob(j); err != nil {
+		return err
+	}
+	go func() {
+		if err := a.executeImportJob(context.Background(), j, nil); err != nil {
+			slog.Error("import failed", "job_id", j.ID, "err", err)
+		}
+	}()
+	return nil
+}
+
+func (a *App) executeImportJob(ctx context.Context, j *ImportJob, onItem func(string, string, Resource, error)) error {
+	stop := a.keepImportClaim(j)
+	defer stop()
+	entries, total, err := scanImportTree(j.Root)
+	if err == nil {
+		err = a.runImportEntries(ctx, j, entries, total, onItem)
+	}
+	if err != nil && !errors.Is(err, errImportClaimLost) {
+		j.Status, j.Error = "failed", err.Error()
+		if serr := a.saveImportJob(j); serr != nil {
+			slog.Error("import: save job failed", "job_id", j.ID, "err", serr)
+		}
+	}
+	return err
+}
+
+func (a *App) runImportEntries(ctx context.Context, j *ImportJob, entries []importEntry, total int64, onItem func(string, string, Resource, error)) error {
+	items, err := a.importItems(j.ID)
+	if err != nil {
+		return err
+	}
+	j.Status, j.Error = "running", ""
+	j.TotalFiles, j.TotalBytes = len(entries), total
+	j.Imported, j.Skipped, j.Failed = 0, 0, 0
+	var done int64
+	for _, e := range entries {
+		switch items[e.rel] {
+		case "imported":
+			j.Imported++
+			done += e.size
+		case "skipped":
+			j.Skipped++
+			done += e.size
+		}
+	}
+	if err := a.saveImportJob(j); err != nil {
+		return err
+	}
+
+	tracker := newProgressTracker(j.ID, filepath.Base(j.Root), total)
+	tracker.mode = "import"
+	if done > 0 {
+		// 续传时从已完成的部分开始计算进度，这部分不计入速度
+		tracker.p.Uploaded, tracker.lastBytes = done, done
+		tracker.save(progressActiveTTL)
+	}
+	for _, e := range entries {
+		if prev := items[e.rel]; prev == "imported" || prev == "skipped" {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			tracker.fail("导入已中断")
+			return err
+		}
+		base := done
+		res, skipped, ferr := a.importTreeFile(ctx, j, e, func(n int64) { tracker.update(base + n) })
+		done += e.size
+		tracker.update(done)
+
+		status := "imported"
+		switch {
+		case errors.Is(dbError(ferr), ErrUnavailable):
+			tracker.fail("数据库不可用")
+			return ferr
+		case ferr != nil:
+			status = "failed"
+			j.Failed++
+			slog.Warn("import: file failed", "job_id", j.ID, "path", e.rel, "err", ferr)
+		case skipped:
+			status = "skipped"
+			j.Skipped++
+		default:
+			j.Imported++
+		}
+		if err := a.saveImportItem(j.ID, e.rel, status, res.ID, ferr); err != nil {
+			tracker.fail("数据库写入失败")
+			return err
+		}
+		if err := a.saveImportJob(j); err != nil {
+			tracker.fail("数据库写入失败")
+			return err
+		}
+		if onItem != nil {
+			onItem(e.rel, status, res, ferr)
+		}
+	}
+
+	j.Status = "completed"
+	if err := a.saveImportJob(j); err != nil {
+		tracker.fail("数据库写入失败")
+		return err
+	}
+	tracker.complete(total)
+	slog.Info("import finished", "job_id", j.ID, "root", j.Root, "imported", j.Imported,
+		"skipped", j.Skipped, "failed", j.Failed)
+	return nil
+}
+
+// resolveImportPath 把请求中的相对路径解析到 IMPORT_ROOT 下，不允许跳出该目录。
+// 符号链接解析后再检查一次，IMPORT_ROOT 下指向其他位置的链接同样会被拒绝。
+func resolveImportPath(p string) (string, bool) {
+	root, err := filepath.Abs(importRoot)
+	if err != nil {
+		return "", false
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", false
+	}
+	full, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(path.Clean("/"+p))))
+	if err != nil {
+		return "", false
+	}
+	if full != root && !strings.HasPrefix(full, root+string(filepath.Separator)) {
+		return "", false
+	}
+	if fi, err := os.Stat(full); err != nil || !fi.IsDir() {
+		return "", false
+	}
+	return full, true
+}
+
+func importJobResponse(j *ImportJob) map[string]interface{} {
+	return map[string]interface{}{"job": j, "progress_url": "/api/upload/progress/" + j.ID}
+}
+
+// handleImports: GET 列出最近的导入任务；POST 从 IMPORT_ROOT 下的目录开始导入，
+// 该目录有未完成的任务时续传该任务
+func (a *App) handleImports(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		rows, err := a.db.Query("SELECT " + importJobColumns + " FROM import_jobs ORDER BY created_at DESC LIMIT 50")
+		if err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		defer rows.Close()
+		jobs := []*ImportJob{}
+		for rows.Next() {
+			j, err := scanImportJob(rows)
+			if err != nil {
+				writeError(w, r, apiDatabase.Wrap(err))
+				return
+			}
+			jobs = append(jobs, j)
+		}
+		if err := rows.Err(); err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		jsonResponse(w, jobs)
+		return
+	}
+	if r.Method != "POST" {
+		writeError(w, r, apiMethodNotAllowed)
+		return
+	}
+
+	var req struct{ Path, Mode, Visibility, Description string }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, apiBadRequest)
+		return
+	}
+	root, ok := resolveImportPath(req.Path)
+	if !ok {
+		writeError(w, r, apiInvalidImportPath)
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = "copy"
+	}
+	if _, local := storage.(*LocalStorage); req.Mode != "copy" && (req.Mode != "link" || !local) {
+		writeError(w, r, apiInvalidImportMode)
+		return
+	}
+	if req.Visibility != "" && !validVisibility[req.Visibility] {
+		writeError(w, r, apiInvalidVisibility)
+		return
+	}
+	uid, _ := strconv.Atoi(r.Header.Get("X-User-ID"))
+	j, err := a.openImportJob(root, req.Mode, ImportOptions{
+		Description: req.Description, Visibility: req.Visibility, UploaderID: uid,
+	})
+	if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	snapshot := *j
+	if err := a.startImportJob(j); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	reqLogger(r).Info("import started", "job_id", j.ID, "root", j.Root, "mode", j.Mode)
+	jsonResponse(w, importJobResponse(&snapshot))
+}
+
+// handleImportOps: GET /api/imports/{id} 查询任务，POST /api/imports/{id}/resume 续传中断或失败的任务
+func (a *App) handleImportOps(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/imports/")
+	id, resume := strings.CutSuffix(id, "/resume")
+	if (resume && r.Method != "POST") || (!resume && r.Method != "GET") {
+		writeError(w, r, apiMethodNotAllowed)
+		return
+	}
+	j, err := a.getImportJob(id)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, apiImportNotFound)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	snapshot := *j
+	if resume && j.Status != "completed" {
+		if err := a.startImportJob(j); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		reqLogger(r).Info("import resumed", "job_id", j.ID, "root", j.Root)
+	}
+	jsonResponse(w, importJobResponse(&snapshot))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportDescriptionSidecar(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "secret")
+	write := func(p, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(outside, "outside the import root")
+	write(filepath.Join(root, "docs", "a.pdf"), "a")
+	write(filepath.Join(root, "docs", "a.pdf"+descSidecarExt), "  quarterly report \n")
+	write(filepath.Join(root, "docs", "b.pdf"), "b")
+	if err := os.Symlink(outside, filepath.Join(root, "docs", "b.pdf"+descSidecarExt)); err != nil {
+		t.Fatal(err)
+	}
+	write(filepath.Join(root, "c.pdf"), "c")
+	if err := os.Mkdir(filepath.Join(root, "c.pdf"+descSidecarExt), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	j := &ImportJob{Root: root, Description: "default"}
+	for rel, want := range map[string]string{
+		"docs/a.pdf": "quarterly report",
+		"docs/b.pdf": "docs", // 指向导入目录外的符号链接被忽略
+		"c.pdf":      "default",
+	} {
+		if got := importDescription(j, rel); got != want {
+			t.Errorf("importDescription(%s) = %q, want %q", rel, got, want)
+		}
+	}
+}
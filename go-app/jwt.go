@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const devJWTSecret = "your-secret-key-change-in-production"
+
+// jwtKeys 保存全部可用于校验的密钥（kid -> secret），新签发的令牌只使用 jwtActiveKID。
+// 轮换步骤：把新密钥加入 JWT_KEYS 并切换 JWT_ACTIVE_KID，旧令牌过期后再移除旧密钥。
+var (
+	jwtKeys      map[string][]byte
+	jwtActiveKID string
+	jwtIssuer    = getEnv("JWT_ISSUER", "resapp")
+	jwtAudience  = getEnv("JWT_AUDIENCE", "resapp-api")
+	jwtTTL       = getEnvDuration("JWT_ACCESS_TTL", 15*time.Minute)
+)
+
+type Claims struct {
+	UserID  int    `json:"user_id"`
+	Role    string `json:"role"`
+	Version int    `json:"ver"`
+	jwt.RegisteredClaims
+}
+
+// initJWTKeys 读取 JWT_KEYS="kid1:secret1,kid2:secret2" 与 JWT_ACTIVE_KID；
+// 未配置 JWT_KEYS 时退回到单个 JWT_SECRET（kid 为 default）。两者都没有配置时拒绝启动：
+// 开发密钥是公开的，任何人都能用它伪造管理员令牌，只有显式设置 JWT_INSECURE_DEV_SECRET=true 才会使用。
+func initJWTKeys() error {
+	jwtKeys = make(map[string][]byte)
+	if raw := getEnv("JWT_KEYS", ""); raw != "" {
+		for _, pair := range strings.Split(raw, ",") {
+			kid, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+			if !ok || kid == "" || secret == "" {
+				return fmt.Errorf("invalid JWT_KEYS entry %q, expected kid:secret", pair)
+			}
+			jwtKeys[kid] = []byte(secret)
+		}
+		jwtActiveKID = getEnv("JWT_ACTIVE_KID", "")
+		if jwtActiveKID == "" {
+			return fmt.Errorf("JWT_ACTIVE_KID is required when JWT_KEYS is set")
+		}
+	} else {
+		secret := getEnv("JWT_SECRET", "")
+		if secret == "" {
+			if getEnv("JWT_INSECURE_DEV_SECRET", "false") != "true" {
+				return fmt.Errorf("JWT_SECRET or JWT_KEYS is required; set JWT_INSECURE_DEV_SECRET=true to use the public development secret for local testing")
+			}
+			slog.Warn("JWT_SECRET not set, using insecure development secret")
+			secret = devJWTSecret
+		}
+		jwtActiveKID = "default"
+		jwtKeys[jwtActiveKID] = []byte(secret)
+	}
+	if _, ok := jwtKeys[jwtActiveKID]; !ok {
+		return fmt.Errorf("JWT_ACTIVE_KID %q not found in JWT_KEYS", jwtActiveKID)
+	}
+	for kid, secret := range jwtKeys {
+		if len(secret) < 32 && string(secret) != devJWTSecret {
+			slog.Warn("JWT key is shorter than 32 bytes", "kid", kid)
+		}
+	}
+	return nil
+}
+
+func generateToken(uid int, role string, version int) (string, error) {
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID:  uid,
+		Role:    role,
+		Version: version,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    jwtIssuer,
+			Audience:  jwt.ClaimStrings{jwtAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(jwtTTL)),
+		},
+	})
+	t.Header["kid"] = jwtActiveKID
+	return t.SignedString(jwtKeys[jwtActiveKID])
+}
+
+func jwtKeyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := jwtKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+func parseClaims(s string) (*Claims, error) {
+	var c Claims
+	_, err := jwt.ParseWithClaims(s, &c, jwtKeyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(jwtIssuer),
+		jwt.WithAudience(jwtAudience),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if c.UserID <= 0 || c.Role == "" {
+		return nil, fmt.Errorf("missing user claims")
+	}
+	return &c, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+// 修改全局的 JWT 密钥和环境变量，不能与其他测试并行
+func TestInitJWTKeysRequiresSecret(t *testing.T) {
+	oldKeys, oldKID := jwtKeys, jwtActiveKID
+	t.Cleanup(func() { jwtKeys, jwtActiveKID = oldKeys, oldKID })
+
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_KEYS", "")
+	if err := initJWTKeys(); err == nil {
+		t.Fatal("initJWTKeys succeeded without a configured key")
+	}
+
+	t.Setenv("JWT_INSECURE_DEV_SECRET", "true")
+	if err := initJWTKeys(); err != nil {
+		t.Fatalf("explicit dev opt-in: %v", err)
+	}
+	if string(jwtKeys[jwtActiveKID]) != devJWTSecret {
+		t.Fatal("dev opt-in did not use the development secret")
+	}
+
+	t.Setenv("JWT_INSECURE_DEV_SECRET", "")
+	t.Setenv("JWT_KEYS", "k1:0123456789abcdef0123456789abcdef,k2:fedcba9876543210fedcba9876543210")
+	t.Setenv("JWT_ACTIVE_KID", "k2")
+	if err := initJWTKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if jwtActiveKID != "k2" || len(jwtKeys) != 2 {
+		t.Fatalf("active kid %q with %d keys, want k2 with 2", jwtActiveKID, len(jwtKeys))
+	}
+}
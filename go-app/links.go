@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const maxLinkTTL = 7 * 24 * time.Hour
+
+var (
+	errLinkInvalid   = errors.New("invalid link signature")
+	errLinkExpired   = errors.New("link expired")
+	errLinkExhausted = errors.New("link usage limit reached")
+
+	publicBaseURL = getEnv("PUBLIC_BASE_URL", "")
+)
+
+var validVisibility = map[string]bool{"public": true, "private": true, "unlisted": true}
+
+// linkKID 返回签名新链接使用的密钥 ID。配置了 DOWNLOAD_LINK_SECRET 时为空，
+// 否则复用当前的 JWT 签名密钥，kid 随链接下发，轮换 JWT 密钥后旧链接仍可校验。
+func linkKID() string {
+	if getEnv("DOWNLOAD_LINK_SECRET", "") != "" {
+		return ""
+	}
+	return jwtActiveKID
+}
+
+// linkSecret 返回 kid 对应的签名密钥；没有 kid 参数的旧链接按当前 JWT 密钥校验
+func linkSecret(kid string) ([]byte, bool) {
+	if s := getEnv("DOWNLOAD_LINK_SECRET", ""); s != "" {
+		return []byte(s), true
+	}
+	if kid == "" {
+		kid = jwtActiveKID
+	}
+	secret, ok := jwtKeys[kid]
+	return secret, ok
+}
+
+func signDownload(secret []byte, id string, expires int64, nonce string) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "download:%s:%d:%s", id, expires, nonce)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkSignedLink 校验 /api/download/{id}?expires=&nonce=&kid=&sig= 形式的签名链接。
+// 带 nonce 的链接有使用次数限制，每次下载消耗一次。HEAD 不消耗；已经使用过的链接，续传的
+// 后续分段也不消耗，否则 max_uses=1 的链接无法断点续传。
+func (a *App) checkSignedLink(r *http.Request, id string) error {
+	q := r.URL.Query()
+	sig := q.Get("sig")
+	if sig == "" {
+		return errLinkInvalid
+	}
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil {
+		return errLinkInvalid
+	}
+	nonce := q.Get("nonce")
+	secret, ok := linkSecret(q.Get("kid"))
+	if !ok || !hmac.Equal([]byte(sig), []byte(signDownload(secret, id, expires, nonce))) {
+		return errLinkInvalid
+	}
+	if time.Now().Unix() > expires {
+		return errLinkExpired
+	}
+	if nonce == "" || r.Method == "HEAD" {
+		return nil
+	}
+	if isRangeContinuation(r) {
+		var uses int
+		err := a.db.QueryRow("SELECT uses FROM download_links WHERE nonce=? AND resource_id=?", nonce, id).Scan(&uses)
+		if err == sql.ErrNoRows {
+			return errLinkInvalid
+		} else if err != nil {
+			return dbError(err)
+		}
+		if uses > 0 {
+			return nil
+		}
+	}
+	err = affected(a.db.Exec("UPDATE download_links SET uses=uses+1 WHERE nonce=? AND resource_id=? AND uses<max_uses",
+		nonce, id))
+	if errors.Is(err, ErrNotFound) {
+		return errLinkExhausted
+	}
+	return err
+}
+
+// canAccessResource 判断调用者能否读取资源内容：public 与 unlisted 对所有人开放，
+// private 需要拥有者/管理员的会话或有效的签名链接
+func (a *App) canAccessResource(r *http.Request, id string, ownerID int, visibility string) error {
+	if visibility != "private" {
+		return nil
+	}
+	if canModify(principalFromRequest(r), ownerID) {
+		return nil
+	}
+	return a.checkSignedLink(r, id)
+}
+
+func writeAccessError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case errLinkExpired:
+		writeError(w, r, apiLinkExpired)
+	case errLinkExhausted:
+		writeError(w, r, apiLinkExhausted)
+	case errLinkInvalid:
+		writeError(w, r, apiAccessDenied)
+	default:
+		writeError(w, r, apiInternal.Wrap(err))
+	}
+}
+
+// handleCreateLink 处理 POST /api/resources/{id}/link，为资源生成带过期时间的签名下载链接
+func (a *App) handleCreateLink(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != "POST" {
+		writeError(w, r, apiMethodNotAllowed)
+		return
+	}
+	res, err := a.getResource(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, apiResourceNotFound)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	p := principalFromRequest(r)
+	if !canModify(p, res.UploaderID) {
+		writeError(w, r, apiResourceForbidden)
+		return
+	}
+
+	var req struct {
+		ExpiresIn int `json:"expires_in"`
+		MaxUses   int `json:"max_uses"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	ttl := time.Hour
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if ttl > maxLinkTTL || req.MaxUses < 0 {
+		writeError(w, r, apiInvalidLinkParams)
+		return
+	}
+	expires := time.Now().Add(ttl)
+
+	nonce := ""
+	if req.MaxUses > 0 {
+		nonce = randomToken(16)
+		_, err := a.db.Exec(`INSERT INTO download_links (nonce,resource_id,max_uses,expires_at,created_by)
+			VALUES (?,?,?,?,?)`, nonce, id, req.MaxUses, expires, p.UserID)
+		if err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+	}
+
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	if nonce != "" {
+		q.Set("nonce", nonce)
+	}
+	kid := linkKID()
+	if kid != "" {
+		q.Set("kid", kid)
+	}
+	secret, _ := linkSecret(kid)
+	q.Set("sig", signDownload(secret, id, expires.Unix(), nonce))
+	jsonResponse(w, map[string]interface{}{
+		"url":        publicBaseURL + "/api/download/" + id + "?" + q.Encode(),
+		"expires_at": expires,
+		"max_uses":   req.MaxUses,
+	})
+}
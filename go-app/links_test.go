@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestSignedLinkUses(t *testing.T) {
+	t.Parallel()
+	ta := newTestApp(t)
+	ta.createUser("alice", "user")
+	ta.createUser("bob", "user")
+	alice, _ := ta.login("alice")
+	bob, _ := ta.login("bob")
+	id, _ := ta.upload(alice, "private.txt", []byte("0123456789"))
+	path := fmt.Sprintf("/api/resources/%d", id)
+	ta.expectJSON(ta.do("PUT", path, alice, map[string]string{"visibility": "private"}), 200, nil)
+
+	ta.expectError(ta.do("GET", fmt.Sprintf("/api/download/%d", id), bob, nil), 403, "ACCESS_DENIED")
+	ta.expectError(ta.do("POST", path+"/link", bob, map[string]int{"max_uses": 1}), 403, "RESOURCE_FORBIDDEN")
+	ta.expectError(ta.do("POST", "/api/resources/999999/link", alice, map[string]int{"max_uses": 1}), 404, "RESOURCE_NOT_FOUND")
+
+	var link struct {
+		URL string `json:"url"`
+	}
+	ta.expectJSON(ta.do("POST", path+"/link", alice, map[string]int{"max_uses": 1}), 200, &link)
+	u, err := url.Parse(link.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := u.RequestURI()
+
+	q := u.Query()
+	sig := []byte(q.Get("sig"))
+	sig[0] ^= 1
+	q.Set("sig", string(sig))
+	ta.expectError(ta.do("GET", u.Path+"?"+q.Encode(), "", nil), 403, "ACCESS_DENIED")
+
+	// HEAD 和 Range 续传不消耗次数，从 0 开始的请求消耗一次
+	ta.expectBody(ta.do("HEAD", signed, "", nil), 200)
+	body := ta.expectBody(ta.do("GET", signed, "", nil, "Range", "bytes=0-3"), 206)
+	if string(body) != "0123" {
+		t.Fatalf("first range %q, want 0123", body)
+	}
+	body = ta.expectBody(ta.do("GET", signed, "", nil, "Range", "bytes=4-"), 206)
+	if string(body) != "456789" {
+		t.Fatalf("continuation %q, want 456789", body)
+	}
+	ta.expectError(ta.do("GET", signed, "", nil), 410, "LINK_EXHAUSTED")
+	// 后缀区间可以取得整个文件，与从 0 开始的请求一样消耗次数
+	ta.expectError(ta.do("GET", signed, "", nil, "Range", "bytes=-100"), 410, "LINK_EXHAUSTED")
+	ta.expectError(ta.do("GET", signed, "", nil, "Range", "bytes=0-3"), 410, "LINK_EXHAUSTED")
+}
+
+// 修改全局的 JWT 密钥，不能与其他测试并行
+func TestSignedLinkKeyRotation(t *testing.T) {
+	ta := newTestApp(t)
+	ta.createUser("alice", "user")
+	alice, _ := ta.login("alice")
+	id, _ := ta.upload(alice, "private.txt", []byte("private"))
+	ta.expectJSON(ta.do("PUT", fmt.Sprintf("/api/resources/%d", id), alice, map[string]string{"visibility": "private"}), 200, nil)
+	var link struct {
+		URL string `json:"url"`
+	}
+	ta.expectJSON(ta.do("POST", fmt.Sprintf("/api/resources/%d/link", id), alice, nil), 200, &link)
+
+	oldKID := jwtActiveKID
+	oldKeys := jwtKeys
+	t.Cleanup(func() { jwtKeys, jwtActiveKID = oldKeys, oldKID })
+	jwtKeys = map[string][]byte{oldKID: oldKeys[oldKID], "next": []byte("fedcba9876543210fedcba9876543210")}
+	jwtActiveKID = "next"
+
+	// 轮换后旧链接按自己的 kid 校验，旧密钥移除后才失效
+	ta.expectBody(ta.do("GET", link.URL, "", nil), 200)
+	delete(jwtKeys, oldKID)
+	ta.expectError(ta.do("GET", link.URL, "", nil), 403, "ACCESS_DENIED")
+}
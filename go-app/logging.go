@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type loggerKey struct{}
+
+// initLogger 按 LOG_FORMAT（json|text）和 LOG_LEVEL（debug|info|warn|error）设置默认 slog 日志，输出到 w
+func initLogger(w io.Writer) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(getEnv("LOG_LEVEL", "info"))); err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler = slog.NewJSONHandler(w, opts)
+	if getEnv("LOG_FORMAT", "json") == "text" {
+		h = slog.NewTextHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// reqLogger 返回带 request_id、route 的请求日志；通过鉴权后还会带上 user_id
+func reqLogger(r *http.Request) *slog.Logger {
+	l, ok := r.Context().Value(loggerKey{}).(*slog.Logger)
+	if !ok {
+		l = slog.Default()
+	}
+	if uid := r.Header.Get("X-User-ID"); uid != "" {
+		l = l.With("user_id", uid)
+	}
+	return l
+}
+
+// requestID 沿用上游（nginx 或调用方）传入的 X-Request-ID，格式不可信时重新生成
+func requestID(r *http.Request) string {
+	id := r.Header.Get("X-Request-ID")
+	if id == "" || len(id) > 64 || strings.IndexFunc(id, func(c rune) bool {
+		return !(c == '-' || c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z')
+	}) >= 0 {
+		return uuid.New().String()
+	}
+	return id
+}
+
+// statusRecorder 记录响应状态码和字节数，同时保留 Flusher 以免影响 SSE
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// requestContext 是每个路由最外层的中间件：分配请求 ID、注入请求日志，
+// 在处理结束后写访问日志并记录指标
+func requestContext(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		// 这些头只能由鉴权中间件设置，先清掉客户端伪造的值
+		r.Header.Del("X-User-ID")
+		r.Header.Del("X-User-Role")
+		r.Header.Del("X-Token-Scopes")
+
+		id := requestID(r)
+		w.Header().Set("X-Request-ID", id)
+		l := slog.Default().With("request_id", id, "route", pattern)
+		r = r.WithContext(context.WithValue(r.Context(), loggerKey{}, l))
+
+		rec := &statusRecorder{ResponseWriter: w, status: 200}
+		next(rec, r)
+
+		elapsed := time.Since(start)
+		observeRequest(pattern, r.Method, rec.status, elapsed)
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+		}
+		reqLogger(r).Log(r.Context(), level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"latency_ms", float64(elapsed.Microseconds())/1000,
+			"ip", clientIP(r),
+		)
+	}
+}
+
+// route 注册路由，统一套上 requestContext
+func route(mux *http.ServeMux, pattern string, h http.HandlerFunc) {
+	mux.HandleFunc(pattern, requestContext(pattern, h))
+}
@@ -1,31 +1,30 @@
 package main
 
 import (
-	"crypto/md5"
-	"database/sql"
-	"encoding/hex"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
 var (
-	db             *sql.DB
-	jwtSecret      = []byte("your-secret-key-change-in-production")
-	uploadDir      = "./uploads"
-	uploadProgress = make(map[string]*UploadProgress)
-	progressMutex  = &sync.RWMutex{}
+	uploadDir = getEnv("UPLOAD_DIR", "./uploads")
+	chunkDir  = getEnv("CHUNK_DIR", "./chunks")
+)
+
+const (
+	maxUploadSize     = 7 * 1024 * 1024 * 1024
+	multipartOverhead = 1 << 20
 )
 
 type UploadProgress struct {
@@ -35,6 +34,7 @@ type UploadProgress struct {
 	FileName     string    `json:"file_name"`
 	Status       string    `json:"status"`
 	ErrorMessage string    `json:"error_message,omitempty"`
+	Speed        float64   `json:"speed"`
 }
 
 type User struct {
@@ -67,84 +67,110 @@ func getEnv(key, defaultValue string) string {
 }
 
 func main() {
-	initDB()
-	defer db.Close()
-	os.MkdirAll(uploadDir, 0755)
-
-	http.HandleFunc("/api/register", corsMiddleware(handleRegister))
-	http.HandleFunc("/api/login", corsMiddleware(handleLogin))
-	http.HandleFunc("/api/user", corsMiddleware(authMiddleware(handleUser)))
-	http.HandleFunc("/api/users", corsMiddleware(adminMiddleware(handleUsers)))
-	http.HandleFunc("/api/users/", corsMiddleware(adminMiddleware(handleUserOps)))
-	http.HandleFunc("/api/resources", corsMiddleware(handleResources))
-	http.HandleFunc("/api/resources/", corsMiddleware(handleResourceOps))
-	http.HandleFunc("/api/upload", corsMiddleware(authMiddleware(handleUpload)))
-	http.HandleFunc("/api/upload/progress/", corsMiddleware(authMiddleware(handleUploadProgress)))
-	http.HandleFunc("/api/download/", corsMiddleware(handleDownload))
-	http.HandleFunc("/api/preview/", corsMiddleware(handlePreview))
-	http.HandleFunc("/api/categories", corsMiddleware(handleCategories))
-	http.HandleFunc("/api/announcements", corsMiddleware(handleAnnouncements))
-	http.HandleFunc("/api/announcements/", corsMiddleware(adminMiddleware(handleAnnouncementOps)))
-	http.HandleFunc("/api/stats", corsMiddleware(handleStats))
-
-	fmt.Println("Server starting on :8080")
-	http.ListenAndServe(":8080", nil)
-}
-
-func initDB() {
-	var err error
-	dbHost := getEnv("DB_HOST", "mysql")
-	dbPort := getEnv("DB_PORT", "3306")
-	dbUser := getEnv("DB_USER", "root")
-	dbPassword := getEnv("DB_PASSWORD", "5210")
-	dbName := getEnv("DB_NAME", "resource_share")
-
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&charset=utf8mb4&collation=utf8mb4_unicode_ci",
-		dbUser, dbPassword, dbHost, dbPort, dbName)
-
-	db, err = sql.Open("mysql", dsn)
-	if err != nil {
-		fmt.Println("Database connection failed:", err)
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	// 子命令的输出写到标准输出，日志改写到标准错误，便于脚本处理
+	logOut := os.Stderr
+	if name == "serve" {
+		logOut = os.Stdout
+	}
+	initLogger(logOut)
+	if err := cmd(args); errors.Is(err, errUsage) {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	} else if err != nil {
+		slog.Error("command failed", "command", name, "err", err)
 		os.Exit(1)
 	}
-
-	if err = db.Ping(); err != nil {
-		fmt.Println("Database ping failed:", err)
-		os.Exit(1)
-	}
-
-	fmt.Println("Database connected successfully")
 }
 
-func hashPassword(p string) string {
-	h := md5.Sum([]byte(p + "salt_resource_share"))
-	return hex.EncodeToString(h[:])
-}
+// runServe 初始化全部依赖后启动 HTTP 服务
+func runServe(args []string) error {
+	if err := initJWTKeys(); err != nil {
+		return fmt.Errorf("JWT config: %w", err)
+	}
+	a, err := openApp()
+	if err != nil {
+		return fmt.Errorf("database init: %w", err)
+	}
+	defer a.db.Close()
+	initMetrics(a.db)
+	if err := initStorage(); err != nil {
+		return fmt.Errorf("storage init: %w", err)
+	}
+	if err := initDelivery(); err != nil {
+		return fmt.Errorf("delivery config: %w", err)
+	}
+	if err := initProgressStore(); err != nil {
+		return fmt.Errorf("progress store init: %w", err)
+	}
+	if err := a.prepareSchema(); err != nil {
+		return fmt.Errorf("schema migration: %w", err)
+	}
+	// 迁移不创建默认管理员，新部署需要先用命令行创建
+	var admins int
+	if err := a.db.QueryRow("SELECT COUNT(*) FROM users WHERE role='admin'").Scan(&admins); err == nil && admins == 0 {
+		slog.Warn("no administrator account, create one with `resapp user create -role admin USERNAME`")
+	}
+	os.MkdirAll(chunkDir, 0755)
+	go a.statsRollupLoop()
+	if reconcileInterval > 0 {
+		go a.reconcileLoop()
+	}
 
-func generateToken(uid int, role string) (string, error) {
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": uid,
-		"role":    role,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
-	}).SignedString(jwtSecret)
+	mux := a.routes()
+	mux.HandleFunc("/metrics", handleMetrics())
+	slog.Info("server starting", "addr", ":8080")
+	return http.ListenAndServe(":8080", mux)
 }
 
-func parseToken(s string) (int, string, error) {
-	t, err := jwt.Parse(s, func(*jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-	if err != nil || !t.Valid {
-		return 0, "", fmt.Errorf("invalid token")
-	}
-	c := t.Claims.(jwt.MapClaims)
-	return int(c["user_id"].(float64)), c["role"].(string), nil
+// routes 注册全部 API 路由。/metrics 只在 runServe 中注册，测试直接使用返回的 mux。
+func (a *App) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	route(mux, "/api/register", corsMiddleware(a.handleRegister))
+	route(mux, "/api/login", corsMiddleware(a.handleLogin))
+	route(mux, "/api/token/refresh", corsMiddleware(a.handleRefresh))
+	route(mux, "/api/logout", corsMiddleware(a.authMiddleware(a.handleLogout)))
+	route(mux, "/api/user", corsMiddleware(a.authMiddleware(a.handleUser)))
+	route(mux, "/api/user/tokens", corsMiddleware(a.authMiddleware(a.handleAPITokens)))
+	route(mux, "/api/user/tokens/", corsMiddleware(a.authMiddleware(a.handleAPITokens)))
+	route(mux, "/api/users", corsMiddleware(a.adminMiddleware(a.handleUsers)))
+	route(mux, "/api/users/", corsMiddleware(a.adminMiddleware(a.handleUserOps)))
+	route(mux, "/api/resources", corsMiddleware(a.handleResources))
+	route(mux, "/api/resources/", corsMiddleware(a.authMutations(a.handleResourceOps)))
+	route(mux, "/api/upload", corsMiddleware(a.authMiddleware(a.handleUpload)))
+	route(mux, "/api/upload/progress/", corsMiddleware(sseTokenFromQuery(a.authMiddleware(handleUploadProgress))))
+	route(mux, "/api/upload/chunk/init", corsMiddleware(a.authMiddleware(a.handleChunkInit)))
+	route(mux, "/api/upload/chunk/", corsMiddleware(a.authMiddleware(a.handleChunkOps)))
+	route(mux, "/api/download/", corsMiddleware(a.optionalAuth(a.handleDownload)))
+	route(mux, "/api/preview/", corsMiddleware(a.optionalAuth(a.handlePreview)))
+	route(mux, "/api/s/", corsMiddleware(a.handleShareInfo))
+	route(mux, "/api/shares", corsMiddleware(a.authMiddleware(a.handleShares)))
+	route(mux, "/api/shares/", corsMiddleware(a.authMiddleware(a.handleShareOps)))
+	route(mux, "/api/categories", corsMiddleware(handleCategories))
+	route(mux, "/api/announcements", corsMiddleware(a.handleAnnouncements))
+	route(mux, "/api/announcements/", corsMiddleware(a.adminMiddleware(a.handleAnnouncementOps)))
+	route(mux, "/api/stats", corsMiddleware(a.handleStats))
+	route(mux, "/api/stats/", corsMiddleware(a.adminMiddleware(a.handleStatsOps)))
+	route(mux, "/api/imports", corsMiddleware(a.adminMiddleware(a.handleImports)))
+	route(mux, "/api/imports/", corsMiddleware(a.adminMiddleware(a.handleImportOps)))
+	route(mux, "/api/reconcile", corsMiddleware(a.adminMiddleware(a.handleReconcile)))
+	route(mux, "/api/", corsMiddleware(handleNotFound))
+	return mux
 }
 
 func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization,X-Upload-ID,X-File-Size,X-Share-Password")
 		w.Header().Set("Access-Control-Max-Age", "86400")
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -154,7 +180,7 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+func (a *App) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "OPTIONS" {
 			next(w, r)
@@ -162,24 +188,54 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 		auth := r.Header.Get("Authorization")
 		if !strings.HasPrefix(auth, "Bearer ") {
-			http.Error(w, `{"error":"unauthorized"}`, 401)
+			writeError(w, r, apiUnauthorized)
 			return
 		}
-		uid, role, err := parseToken(strings.TrimPrefix(auth, "Bearer "))
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if strings.HasPrefix(token, apiKeyPrefix) {
+			p, scopes, err := a.authenticateAPIKey(token)
+			if errors.Is(err, ErrUnavailable) {
+				writeError(w, r, apiUnavailable.Wrap(err))
+				return
+			} else if err != nil {
+				writeError(w, r, apiInvalidAPIKey)
+				return
+			}
+			if !scopeAllows(scopes, r) {
+				writeError(w, r, apiInsufficientScope)
+				return
+			}
+			r.Header.Set("X-User-ID", strconv.Itoa(p.UserID))
+			r.Header.Set("X-User-Role", p.Role)
+			r.Header.Set("X-Token-Scopes", strings.Join(scopes, ","))
+			next(w, r)
+			return
+		}
+		r.Header.Del("X-Token-Scopes")
+		c, err := parseClaims(token)
 		if err != nil {
-			http.Error(w, `{"error":"invalid token"}`, 401)
+			jwtFailures.WithLabelValues("invalid").Inc()
+			writeError(w, r, apiInvalidToken)
 			return
 		}
-		r.Header.Set("X-User-ID", strconv.Itoa(uid))
-		r.Header.Set("X-User-Role", role)
+		if err := a.checkTokenVersion(c.UserID, c.Version); errors.Is(err, ErrUnavailable) {
+			writeError(w, r, apiUnavailable.Wrap(err))
+			return
+		} else if err != nil {
+			jwtFailures.WithLabelValues("revoked").Inc()
+			writeError(w, r, apiTokenRevoked)
+			return
+		}
+		r.Header.Set("X-User-ID", strconv.Itoa(c.UserID))
+		r.Header.Set("X-User-Role", c.Role)
 		next(w, r)
 	}
 }
 
-func adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+func (a *App) adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return a.authMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("X-User-Role") != "admin" {
-			http.Error(w, `{"error":"admin required"}`, 403)
+			writeError(w, r, apiAdminRequired)
 			return
 		}
 		next(w, r)
@@ -191,58 +247,88 @@ func jsonResponse(w http.ResponseWriter, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-func handleRegister(w http.ResponseWriter, r *http.Request) {
+func (a *App) handleRegister(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
+		writeError(w, r, apiMethodNotAllowed)
 		return
 	}
 	var req struct{ Username, Password string }
 	json.NewDecoder(r.Body).Decode(&req)
 	if len(req.Username) < 3 || len(req.Password) < 6 {
-		http.Error(w, `{"error":"用户名至少3位，密码至少6位"}`, 400)
+		writeError(w, r, apiInvalidSignup)
 		return
 	}
-	_, err := db.Exec("INSERT INTO users (username,password) VALUES (?,?)", req.Username, hashPassword(req.Password))
+	hash, err := hashPassword(req.Password)
 	if err != nil {
-		http.Error(w, `{"error":"用户名已存在"}`, 400)
+		writeError(w, r, apiPasswordTooLong)
+		return
+	}
+	if _, err := a.users.Create(r.Context(), req.Username, hash, "user"); errors.Is(err, ErrConflict) {
+		writeError(w, r, apiUsernameTaken)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
 		return
 	}
 	jsonResponse(w, map[string]string{"message": "注册成功"})
 }
 
-func handleLogin(w http.ResponseWriter, r *http.Request) {
+func (a *App) handleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
+		writeError(w, r, apiMethodNotAllowed)
 		return
 	}
 	var req struct{ Username, Password string }
 	json.NewDecoder(r.Body).Decode(&req)
-	var u User
-	err := db.QueryRow("SELECT id,username,role FROM users WHERE username=? AND password=?",
-		req.Username, hashPassword(req.Password)).Scan(&u.ID, &u.Username, &u.Role)
+	c, err := a.users.Credentials(r.Context(), req.Username)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, apiInvalidCredentials)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	ok, needsRehash := verifyPassword(c.PasswordHash, req.Password)
+	if !ok {
+		writeError(w, r, apiInvalidCredentials)
+		return
+	}
+	if needsRehash {
+		if newHash, err := hashPassword(req.Password); err == nil {
+			// 升级失败不影响本次登录，下次登录会再次尝试
+			if err := a.users.Rehash(r.Context(), c.ID, c.PasswordHash, newHash); err != nil {
+				reqLogger(r).Warn("password rehash failed", "user_id", c.ID, "err", err)
+			}
+		}
+	}
+	resp, err := a.issueSession(c.ID, c.Role, c.TokenVersion, "")
 	if err != nil {
-		http.Error(w, `{"error":"用户名或密码错误"}`, 401)
+		writeError(w, r, apiDatabase.Wrap(err))
 		return
 	}
-	token, _ := generateToken(u.ID, u.Role)
-	jsonResponse(w, map[string]interface{}{"token": token, "user": u})
+	resp["user"] = c.User
+	jsonResponse(w, resp)
 }
 
-func handleUser(w http.ResponseWriter, r *http.Request) {
+func (a *App) handleUser(w http.ResponseWriter, r *http.Request) {
 	uid, _ := strconv.Atoi(r.Header.Get("X-User-ID"))
-	var u User
-	db.QueryRow("SELECT id,username,role,created_at FROM users WHERE id=?", uid).
-		Scan(&u.ID, &u.Username, &u.Role, &u.Created)
+	u, err := a.users.Get(r.Context(), uid)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, apiUserNotFound)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
 	jsonResponse(w, u)
 }
 
-func handleUsers(w http.ResponseWriter, r *http.Request) {
+func (a *App) handleUsers(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
-		rows, _ := db.Query("SELECT id,username,role,created_at FROM users ORDER BY id")
-		defer rows.Close()
-		var users []User
-		for rows.Next() {
-			var u User
-			rows.Scan(&u.ID, &u.Username, &u.Role, &u.Created)
-			users = append(users, u)
+		users, err := a.users.List(r.Context())
+		if err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
 		}
 		jsonResponse(w, users)
 	} else if r.Method == "POST" {
@@ -251,31 +337,135 @@ func handleUsers(w http.ResponseWriter, r *http.Request) {
 		if req.Role == "" {
 			req.Role = "user"
 		}
-		db.Exec("INSERT INTO users (username,password,role) VALUES (?,?,?)",
-			req.Username, hashPassword(req.Password), req.Role)
-		jsonResponse(w, map[string]string{"message": "创建成功"})
+		if !validRole(req.Role) {
+			writeError(w, r, apiInvalidRole)
+			return
+		}
+		if len(req.Username) < 3 || len(req.Password) < 6 {
+			writeError(w, r, apiInvalidSignup)
+			return
+		}
+		hash, err := hashPassword(req.Password)
+		if err != nil {
+			writeError(w, r, apiPasswordTooLong)
+			return
+		}
+		id, err := a.users.Create(r.Context(), req.Username, hash, req.Role)
+		if errors.Is(err, ErrConflict) {
+			writeError(w, r, apiUsernameTaken)
+			return
+		} else if err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		jsonResponse(w, map[string]interface{}{"message": "创建成功", "id": id})
+	} else {
+		writeError(w, r, apiMethodNotAllowed)
 	}
 }
 
-func handleUserOps(w http.ResponseWriter, r *http.Request) {
-	id := strings.TrimPrefix(r.URL.Path, "/api/users/")
+// isLastAdmin 判断用户是否是唯一的管理员。至少保留一个管理员，否则只能回到命令行创建，
+// 删除用户和把管理员改为普通用户之前都要检查。
+func (a *App) isLastAdmin(ctx context.Context, id int) (bool, error) {
+	var role string
+	var admins int
+	err := a.db.QueryRowContext(ctx, `SELECT u.role,(SELECT COUNT(*) FROM users WHERE role='admin')
+		FROM users u WHERE u.id=?`, id).Scan(&role, &admins)
+	if err != nil {
+		return false, dbError(err)
+	}
+	return role == "admin" && admins <= 1, nil
+}
+
+func (a *App) handleUserOps(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/users/"))
+	if err != nil {
+		writeError(w, r, apiUserNotFound)
+		return
+	}
 	if r.Method == "PUT" {
-		var req struct{ Username, Password, Role string }
-		json.NewDecoder(r.Body).Decode(&req)
-		if req.Password != "" {
-			db.Exec("UPDATE users SET username=?,password=?,role=? WHERE id=?",
-				req.Username, hashPassword(req.Password), req.Role, id)
-		} else {
-			db.Exec("UPDATE users SET username=?,role=? WHERE id=?", req.Username, req.Role, id)
+		// 只修改请求中出现的字段
+		var req struct{ Username, Password, Role *string }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, apiBadRequest)
+			return
+		}
+		if req.Role != nil && !validRole(*req.Role) {
+			writeError(w, r, apiInvalidRole)
+			return
+		}
+		if (req.Username != nil && len(*req.Username) < 3) || (req.Password != nil && len(*req.Password) < 6) {
+			writeError(w, r, apiInvalidSignup)
+			return
+		}
+		var hash *string
+		if req.Password != nil {
+			h, err := hashPassword(*req.Password)
+			if err != nil {
+				writeError(w, r, apiPasswordTooLong)
+				return
+			}
+			hash = &h
+		}
+		if req.Role != nil && *req.Role != "admin" {
+			last, err := a.isLastAdmin(r.Context(), id)
+			if errors.Is(err, ErrNotFound) {
+				writeError(w, r, apiUserNotFound)
+				return
+			} else if err != nil {
+				writeError(w, r, apiDatabase.Wrap(err))
+				return
+			}
+			if last {
+				writeError(w, r, apiProtectedUser)
+				return
+			}
+		}
+		switch err := a.users.Update(r.Context(), id, req.Username, req.Role, hash); {
+		case errors.Is(err, ErrNotFound):
+			writeError(w, r, apiUserNotFound)
+			return
+		case errors.Is(err, ErrConflict):
+			writeError(w, r, apiUsernameTaken)
+			return
+		case err != nil:
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		if hash != nil {
+			if err := a.revokeUserRefreshTokens(id); err != nil {
+				writeError(w, r, apiDatabase.Wrap(err))
+				return
+			}
 		}
 		jsonResponse(w, map[string]string{"message": "更新成功"})
 	} else if r.Method == "DELETE" {
-		db.Exec("DELETE FROM users WHERE id=? AND id!=1", id)
+		last, err := a.isLastAdmin(r.Context(), id)
+		if errors.Is(err, ErrNotFound) {
+			writeError(w, r, apiUserNotFound)
+			return
+		} else if err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		if last {
+			writeError(w, r, apiProtectedUser)
+			return
+		}
+		if err := a.users.Delete(r.Context(), id); errors.Is(err, ErrNotFound) {
+			writeError(w, r, apiUserNotFound)
+			return
+		} else if err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
 		jsonResponse(w, map[string]string{"message": "删除成功"})
+	} else {
+		writeError(w, r, apiMethodNotAllowed)
 	}
 }
 
-func handleResources(w http.ResponseWriter, r *http.Request) {
+func (a *App) handleResources(w http.ResponseWriter, r *http.Request) {
 	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
 	if page < 1 {
 		page = 1
@@ -284,45 +474,20 @@ func handleResources(w http.ResponseWriter, r *http.Request) {
 	if l, _ := strconv.Atoi(r.URL.Query().Get("limit")); l > 0 {
 		limit = l
 	}
-	offset := (page - 1) * limit
-	cat, search := r.URL.Query().Get("category"), r.URL.Query().Get("search")
-
-	query := `SELECT r.id,r.name,r.orig_name,r.size,r.category,r.description,r.file_type,
-		COALESCE(u.username,''),r.downloads,r.created_at FROM resources r 
-		LEFT JOIN users u ON r.uploader_id=u.id WHERE 1=1`
-	countQ := "SELECT COUNT(*) FROM resources r WHERE 1=1"
-	var args []interface{}
-
-	if cat != "" && cat != "全部" {
-		query += " AND r.category=?"
-		countQ += " AND category=?"
-		args = append(args, cat)
+	f := ResourceFilter{
+		Category: r.URL.Query().Get("category"),
+		Search:   r.URL.Query().Get("search"),
+		Limit:    limit,
+		Offset:   (page - 1) * limit,
 	}
-	if search != "" {
-		query += " AND (r.orig_name LIKE ? OR r.description LIKE ?)"
-		countQ += " AND (orig_name LIKE ? OR description LIKE ?)"
-		args = append(args, "%"+search+"%", "%"+search+"%")
+	if f.Category == "全部" {
+		f.Category = ""
 	}
 
-	var total int
-	db.QueryRow(countQ, args...).Scan(&total)
-
-	query += " ORDER BY r.id DESC LIMIT ? OFFSET ?"
-	args = append(args, limit, offset)
-	rows, _ := db.Query(query, args...)
-	defer rows.Close()
-
-	var resources []map[string]interface{}
-	for rows.Next() {
-		var id, downloads int
-		var name, origName, cat, desc, ft, uploader, created string
-		var size int64
-		rows.Scan(&id, &name, &origName, &size, &cat, &desc, &ft, &uploader, &downloads, &created)
-		resources = append(resources, map[string]interface{}{
-			"id": id, "name": name, "orig_name": origName, "size": size, "category": cat,
-			"description": desc, "file_type": ft, "uploader": uploader, "downloads": downloads,
-			"created": created, "preview": getPreviewType(ft),
-		})
+	resources, total, err := a.resources.List(r.Context(), f)
+	if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
 	}
 
 	pages := (total + limit - 1) / limit
@@ -334,249 +499,337 @@ func handleResources(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func handleResourceOps(w http.ResponseWriter, r *http.Request) {
+func (a *App) handleResourceOps(w http.ResponseWriter, r *http.Request) {
 	id := strings.TrimPrefix(r.URL.Path, "/api/resources/")
+	if rid, ok := strings.CutSuffix(id, "/link"); ok {
+		a.handleCreateLink(w, r, rid)
+		return
+	}
+	if r.Method != "GET" && r.Method != "PUT" && r.Method != "DELETE" {
+		writeError(w, r, apiMethodNotAllowed)
+		return
+	}
+
+	res, err := a.getResource(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, apiResourceNotFound)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
 
 	if r.Method == "GET" {
-		var rid, downloads int
-		var name, origName, cat, desc, ft, uploader, created, fp string
-		var size int64
-		err := db.QueryRow(`SELECT r.id,r.name,r.orig_name,r.size,r.category,r.description,
-			r.file_type,COALESCE(u.username,''),r.downloads,r.created_at,r.file_path 
-			FROM resources r LEFT JOIN users u ON r.uploader_id=u.id WHERE r.id=?`, id).
-			Scan(&rid, &name, &origName, &size, &cat, &desc, &ft, &uploader, &downloads, &created, &fp)
-		if err != nil {
-			http.Error(w, `{"error":"资源不存在"}`, 404)
+		// 私有资源对无权限者表现为不存在
+		if res.Visibility == "private" && !canModify(principalFromRequest(r), res.UploaderID) {
+			writeError(w, r, apiResourceNotFound)
 			return
 		}
-		jsonResponse(w, map[string]interface{}{
-			"id": rid, "name": name, "orig_name": origName, "size": size, "category": cat,
-			"description": desc, "file_type": ft, "uploader": uploader, "downloads": downloads,
-			"created": created, "preview": getPreviewType(ft),
-		})
-	} else if r.Method == "PUT" {
-		var req struct{ Description string }
+		jsonResponse(w, res)
+		return
+	}
+
+	if !canModify(principalFromRequest(r), res.UploaderID) {
+		writeError(w, r, apiResourceForbidden)
+		return
+	}
+
+	if r.Method == "PUT" {
+		// 只更新请求中出现的字段，未出现的字段保持原值
+		var req struct{ Description, Visibility *string }
 		json.NewDecoder(r.Body).Decode(&req)
-		db.Exec("UPDATE resources SET description=? WHERE id=?", req.Description, id)
+		if req.Visibility != nil && !validVisibility[*req.Visibility] {
+			writeError(w, r, apiInvalidVisibility)
+			return
+		}
+		if err := a.resources.Update(r.Context(), res.ID, req.Description, req.Visibility); errors.Is(err, ErrNotFound) {
+			writeError(w, r, apiResourceNotFound)
+			return
+		} else if err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
 		jsonResponse(w, map[string]string{"message": "更新成功"})
-	} else if r.Method == "DELETE" {
-		var fp string
-		db.QueryRow("SELECT file_path FROM resources WHERE id=?", id).Scan(&fp)
-		if fp != "" {
-			os.Remove(fp)
+	} else {
+		if err := a.resources.Delete(r.Context(), res.ID); errors.Is(err, ErrNotFound) {
+			writeError(w, r, apiResourceNotFound)
+			return
+		} else if err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		// 记录已删除，文件释放失败只会留下孤儿文件，不影响本次结果
+		if err := a.releaseBlob(r.Context(), res.SHA256, res.StorageKey); err != nil {
+			reqLogger(r).Error("release blob failed", "resource_id", res.ID, "key", res.StorageKey, "err", err)
 		}
-		db.Exec("DELETE FROM resources WHERE id=?", id)
 		jsonResponse(w, map[string]string{"message": "删除成功"})
 	}
 }
 
+// getResource 按路径中的 ID 查询资源，ID 非数字时按不存在处理
+func (a *App) getResource(ctx context.Context, id string) (Resource, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return Resource{}, ErrNotFound
+	}
+	return a.resources.Get(ctx, n)
+}
+
 func handleUploadProgress(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
+		writeError(w, r, apiMethodNotAllowed)
 		return
 	}
 
 	uploadID := strings.TrimPrefix(r.URL.Path, "/api/upload/progress/")
-	fmt.Println("Progress query for uploadID:", uploadID)
-	
-	if uploadID == "" {
-		fmt.Println("uploadID is empty")
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error":"upload ID required"}`, 400)
+	if id, ok := strings.CutSuffix(uploadID, "/stream"); ok && id != "" {
+		handleUploadProgressStream(w, r, id)
 		return
 	}
-
-	progressMutex.RLock()
-	progress, exists := uploadProgress[uploadID]
-	progressMutex.RUnlock()
-
-	fmt.Println("Progress exists:", exists, "uploaded:", progress.Uploaded, "total:", progress.TotalSize)
-
-	if !exists {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error":"upload not found"}`, 404)
+	if uploadID == "" {
+		writeError(w, r, apiUploadIDRequired)
 		return
 	}
 
-	elapsed := time.Since(progress.StartTime).Seconds()
-	var speed float64
-	if elapsed > 0 {
-		speed = float64(progress.Uploaded) / elapsed
-	}
-
-	progressPercent := 0.0
-	if progress.TotalSize > 0 {
-		progressPercent = float64(progress.Uploaded) / float64(progress.TotalSize) * 100
+	progress, err := progressStore.Get(r.Context(), uploadID)
+	if err == ErrProgressNotFound {
+		writeError(w, r, apiUploadNotFound)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
 	}
-
-	jsonResponse(w, map[string]interface{}{
-		"upload_id":      uploadID,
-		"total_size":     progress.TotalSize,
-		"uploaded":       progress.Uploaded,
-		"progress":       progressPercent,
-		"speed":          speed,
-		"status":         progress.Status,
-		"file_name":      progress.FileName,
-		"error_message":  progress.ErrorMessage,
-		"elapsed_time":   elapsed,
-	})
+	jsonResponse(w, progress.snapshot(uploadID))
 }
 
-func handleUpload(w http.ResponseWriter, r *http.Request) {
+// handleUpload 用 multipart.Reader 逐个读取表单分段，文件内容直接写入最终位置，
+// 不经过 ParseMultipartForm 的内存/临时文件缓冲。客户端可以通过 X-Upload-ID 预先指定
+// 进度 ID，从而在上传过程中就开始轮询；X-File-Size 用于给出准确的总大小。
+func (a *App) handleUpload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, `{"error":"Method not allowed"}`, 405)
+		writeError(w, r, apiMethodNotAllowed)
 		return
 	}
 
-	fmt.Println("Upload request received from user:", r.Header.Get("X-User-ID"))
-	uploadID := uuid.New().String()
-	const maxUploadSize = 7 * 1024 * 1024 * 1024
-	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
-
-	err := r.ParseMultipartForm(100 << 20)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		if strings.Contains(err.Error(), "request body too large") {
-			http.Error(w, `{"error":"文件大小超过7GB限制"}`, 400)
-			return
-		}
-		http.Error(w, `{"error":"读取文件失败"}`, 400)
+	w.Header().Set("Content-Type", "application/json")
+	if r.ContentLength > maxUploadSize+multipartOverhead {
+		writeError(w, r, apiFileTooLarge)
 		return
 	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+multipartOverhead)
 
-	file, header, err := r.FormFile("file")
+	mr, err := r.MultipartReader()
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error":"读取文件失败"}`, 400)
+		writeError(w, r, apiInvalidUpload)
 		return
 	}
-	defer file.Close()
 
-	progressMutex.Lock()
-	uploadProgress[uploadID] = &UploadProgress{
-		TotalSize: header.Size,
-		Uploaded:  0,
-		StartTime: time.Now(),
-		FileName:  header.Filename,
-		Status:    "uploading",
+	uploadID := uuid.New().String()
+	if id := r.Header.Get("X-Upload-ID"); id != "" {
+		if _, err := uuid.Parse(id); err == nil {
+			if _, err := progressStore.Get(r.Context(), id); err == ErrProgressNotFound {
+				uploadID = id
+			}
+		}
 	}
-	progressMutex.Unlock()
 
-	ext := filepath.Ext(header.Filename)
-	newName := uuid.New().String() + ext
-	filePath := filepath.Join(uploadDir, newName)
+	var description, origName, newName, digest string
+	visibility := "public"
+	var written int64
+	var tracker *progressTracker
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if newName != "" {
+				storage.Delete(r.Context(), newName)
+			}
+			tracker.fail("读取文件失败")
+			writeError(w, r, apiInvalidUpload)
+			return
+		}
 
-	dst, err := os.Create(filePath)
-	if err != nil {
-		progressMutex.Lock()
-		uploadProgress[uploadID].Status = "error"
-		uploadProgress[uploadID].ErrorMessage = "创建文件失败"
-		progressMutex.Unlock()
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error":"创建文件失败"}`, 500)
-		return
+		switch part.FormName() {
+		case "description":
+			b, _ := io.ReadAll(io.LimitReader(part, 64<<10))
+			description = string(b)
+		case "visibility":
+			b, _ := io.ReadAll(io.LimitReader(part, 16))
+			if v := string(b); validVisibility[v] {
+				visibility = v
+			}
+		case "file":
+			if newName != "" {
+				part.Close()
+				continue
+			}
+			origName = filepath.Base(part.FileName())
+			total, _ := strconv.ParseInt(r.Header.Get("X-File-Size"), 10, 64)
+			if total <= 0 {
+				total = r.ContentLength
+			}
+			tracker = newProgressTracker(uploadID, origName, total)
+
+			ext := filepath.Ext(origName)
+			newName = uuid.New().String() + ext
+			written, digest, err = streamToStorage(r.Context(), newName, part, tracker)
+			if err != nil {
+				storage.Delete(r.Context(), newName)
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) || errors.Is(err, errUploadTooLarge) {
+					tracker.fail("文件大小超过7GB限制")
+					writeError(w, r, apiFileTooLarge)
+					return
+				}
+				tracker.fail("保存文件失败")
+				writeError(w, r, apiStorage.Wrap(err))
+				return
+			}
+		}
+		part.Close()
 	}
-	defer dst.Close()
 
-	progressReader := &ProgressReader{
-		Reader: file,
-		OnProgress: func(read int64) {
-			progressMutex.Lock()
-			if progress, exists := uploadProgress[uploadID]; exists {
-				progress.Uploaded = read
-			}
-			progressMutex.Unlock()
-		},
+	if newName == "" {
+		writeError(w, r, apiInvalidUpload)
+		return
 	}
 
-	written, err := io.Copy(dst, progressReader)
+	key, err := a.acquireBlob(r.Context(), newName, digest, written)
 	if err != nil {
-		os.Remove(filePath)
-		progressMutex.Lock()
-		uploadProgress[uploadID].Status = "error"
-		uploadProgress[uploadID].ErrorMessage = "保存文件失败"
-		progressMutex.Unlock()
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error":"保存文件失败"}`, 500)
+		storage.Delete(r.Context(), newName)
+		tracker.fail("数据库写入失败")
+		writeError(w, r, apiDatabase.Wrap(err))
 		return
 	}
 
 	uid, _ := strconv.Atoi(r.Header.Get("X-User-ID"))
-	ft := getFileType(ext)
+	ft := getFileType(filepath.Ext(origName))
 	cat := getCategoryFromFileType(ft)
-	description := r.FormValue("description")
-
-	res, err := db.Exec(`INSERT INTO resources (name,orig_name,size,category,description,
-		file_path,file_type,uploader_id) VALUES (?,?,?,?,?,?,?,?)`,
-		newName, header.Filename, written, cat, description, filePath, ft, uid)
 
+	id, err := a.resources.Create(r.Context(), &Resource{
+		OrigName: origName, Size: written, Category: cat, Description: description,
+		StorageKey: key, SHA256: digest, FileType: ft, UploaderID: uid, Visibility: visibility,
+	})
 	if err != nil {
-		os.Remove(filePath)
-		progressMutex.Lock()
-		uploadProgress[uploadID].Status = "error"
-		uploadProgress[uploadID].ErrorMessage = "数据库写入失败"
-		progressMutex.Unlock()
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error":"数据库写入失败"}`, 500)
+		a.releaseBlob(r.Context(), digest, key)
+		tracker.fail("数据库写入失败")
+		writeError(w, r, apiDatabase.Wrap(err))
 		return
 	}
 
-	progressMutex.Lock()
-	uploadProgress[uploadID].Status = "completed"
-	uploadProgress[uploadID].Uploaded = written
-	progressMutex.Unlock()
+	tracker.complete(written)
+	reqLogger(r).Info("upload completed", "upload_id", uploadID, "resource_id", id, "file", origName, "size", written)
 
-	fmt.Println("Upload completed, uploadID:", uploadID, "file:", header.Filename, "size:", written)
-	
-	id, _ := res.LastInsertId()
 	jsonResponse(w, map[string]interface{}{
 		"id":        id,
 		"category":  cat,
 		"message":   "上传成功",
 		"upload_id": uploadID,
+		"sha256":    digest,
 	})
+}
+
+var errUploadTooLarge = errors.New("upload exceeds size limit")
 
-	go func() {
-		time.Sleep(5 * time.Minute)
-		progressMutex.Lock()
-		delete(uploadProgress, uploadID)
-		progressMutex.Unlock()
-	}()
+// streamToStorage 把文件分段写入存储，同时计算 SHA-256、更新上传进度并限制最大大小
+func streamToStorage(ctx context.Context, key string, src io.Reader, tracker *progressTracker) (int64, string, error) {
+	progressReader := &ProgressReader{
+		Reader:     src,
+		OnProgress: tracker.update,
+	}
+	// 超限时让 Put 失败，避免把超大文件完整写入存储
+	hr := newHashingReader(&sizeGuard{Reader: progressReader, limit: maxUploadSize})
+	written, err := storage.Put(ctx, key, hr, -1)
+	return written, hr.Sum(), err
 }
 
-func handleDownload(w http.ResponseWriter, r *http.Request) {
+type sizeGuard struct {
+	io.Reader
+	limit int64
+	read  int64
+}
+
+func (g *sizeGuard) Read(p []byte) (int, error) {
+	n, err := g.Reader.Read(p)
+	g.read += int64(n)
+	if g.read > g.limit {
+		return n, errUploadTooLarge
+	}
+	return n, err
+}
+
+func (a *App) handleDownload(w http.ResponseWriter, r *http.Request) {
 	id := strings.TrimPrefix(r.URL.Path, "/api/download/")
-	var fp, origName string
-	err := db.QueryRow("SELECT file_path,orig_name FROM resources WHERE id=?", id).Scan(&fp, &origName)
-	if err != nil || fp == "" {
-		http.Error(w, "Not found", 404)
+	shared := false
+	if slug, ok := strings.CutPrefix(id, "s/"); ok {
+		if id, ok = a.resolveShareLink(w, r, slug, "download"); !ok {
+			return
+		}
+		shared = true
+	}
+	res, ok := a.servableResource(w, r, id, shared)
+	if !ok {
 		return
 	}
-	db.Exec("UPDATE resources SET downloads=downloads+1 WHERE id=?", id)
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, origName))
-	http.ServeFile(w, r, fp)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, res.OrigName))
+	if res.SHA256 != "" {
+		w.Header().Set("X-Checksum-SHA256", res.SHA256)
+	}
+	status, n := serveObject(w, r, res.StorageKey, res.OrigName)
+	a.recordDownload(r, id, status, n)
 }
 
-func handlePreview(w http.ResponseWriter, r *http.Request) {
+func (a *App) handlePreview(w http.ResponseWriter, r *http.Request) {
 	id := strings.TrimPrefix(r.URL.Path, "/api/preview/")
-	var fp, ft string
-	err := db.QueryRow("SELECT file_path,file_type FROM resources WHERE id=?", id).Scan(&fp, &ft)
-	if err != nil || fp == "" {
-		http.Error(w, "Not found", 404)
+	shared := false
+	if slug, ok := strings.CutPrefix(id, "s/"); ok {
+		if id, ok = a.resolveShareLink(w, r, slug, "preview"); !ok {
+			return
+		}
+		shared = true
+	}
+	res, ok := a.servableResource(w, r, id, shared)
+	if !ok {
 		return
 	}
-	switch ft {
+	key := res.StorageKey
+	switch res.FileType {
 	case "image", "video", "audio", "pdf":
-		http.ServeFile(w, r, fp)
+		serveObject(w, r, key, key)
 	case "text", "code":
-		data, _ := os.ReadFile(fp)
-		if len(data) > 50000 {
-			data = data[:50000]
+		body, err := storage.Get(r.Context(), key, 0, 50000)
+		if err != nil {
+			writeError(w, r, apiResourceNotFound)
+			return
 		}
+		data, _ := io.ReadAll(body)
+		body.Close()
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.Write(data)
 	default:
-		http.Error(w, "Preview not supported", 400)
+		writeError(w, r, apiPreviewUnsupported)
+	}
+}
+
+// servableResource 查询待下载/预览的资源并检查访问权限，失败时已写入错误响应
+func (a *App) servableResource(w http.ResponseWriter, r *http.Request, id string, shared bool) (Resource, bool) {
+	res, err := a.getResource(r.Context(), id)
+	if errors.Is(err, ErrNotFound) || err == nil && res.StorageKey == "" {
+		writeError(w, r, apiResourceNotFound)
+		return res, false
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return res, false
+	}
+	if !shared {
+		if err := a.canAccessResource(r, id, res.UploaderID, res.Visibility); err != nil {
+			writeAccessError(w, r, err)
+			return res, false
+		}
 	}
+	return res, true
 }
 
 func handleCategories(w http.ResponseWriter, r *http.Request) {
@@ -584,45 +837,60 @@ func handleCategories(w http.ResponseWriter, r *http.Request) {
 		"代码", "电子书", "设计资源", "字体", "办公模板", "学习资料", "游戏", "其他"})
 }
 
-func handleAnnouncements(w http.ResponseWriter, r *http.Request) {
+func (a *App) handleAnnouncements(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
-		rows, _ := db.Query("SELECT id,title,content,created_at FROM announcements ORDER BY id DESC LIMIT 10")
-		defer rows.Close()
-		var anns []map[string]interface{}
-		for rows.Next() {
-			var id int
-			var title, content, created string
-			rows.Scan(&id, &title, &content, &created)
-			anns = append(anns, map[string]interface{}{
-				"id": id, "title": title, "content": content, "created": created,
-			})
-		}
-		if anns == nil {
-			anns = []map[string]interface{}{}
+		anns, err := a.announcements.List(r.Context(), 10)
+		if err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
 		}
 		jsonResponse(w, anns)
 	} else if r.Method == "POST" {
 		var req struct{ Title, Content string }
 		json.NewDecoder(r.Body).Decode(&req)
-		db.Exec("INSERT INTO announcements (title,content) VALUES (?,?)", req.Title, req.Content)
-		jsonResponse(w, map[string]string{"message": "发布成功"})
+		id, err := a.announcements.Create(r.Context(), req.Title, req.Content)
+		if err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		jsonResponse(w, map[string]interface{}{"message": "发布成功", "id": id})
+	} else {
+		writeError(w, r, apiMethodNotAllowed)
 	}
 }
 
-func handleAnnouncementOps(w http.ResponseWriter, r *http.Request) {
-	id := strings.TrimPrefix(r.URL.Path, "/api/announcements/")
-	if r.Method == "DELETE" {
-		db.Exec("DELETE FROM announcements WHERE id=?", id)
-		jsonResponse(w, map[string]string{"message": "删除成功"})
+func (a *App) handleAnnouncementOps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		writeError(w, r, apiMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/announcements/"))
+	if err == nil {
+		err = a.announcements.Delete(r.Context(), id)
+	} else {
+		err = ErrNotFound
+	}
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, apiAnnouncementNotFound)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
 	}
+	jsonResponse(w, map[string]string{"message": "删除成功"})
 }
 
-func handleStats(w http.ResponseWriter, r *http.Request) {
-	var files, users, downloads int
-	var size int64
-	db.QueryRow("SELECT COUNT(*),COALESCE(SUM(size),0),COALESCE(SUM(downloads),0) FROM resources").
-		Scan(&files, &size, &downloads)
-	db.QueryRow("SELECT COUNT(*) FROM users").Scan(&users)
+func (a *App) handleStats(w http.ResponseWriter, r *http.Request) {
+	files, size, downloads, err := a.resources.Totals(r.Context())
+	if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	users, err := a.users.Count(r.Context())
+	if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
 	jsonResponse(w, map[string]interface{}{
 		"files": files, "users": users, "downloads": downloads, "size": size,
 	})
@@ -678,4 +946,4 @@ func getPreviewType(ft string) string {
 	default:
 		return "none"
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestUploadDedup(t *testing.T) {
+	t.Parallel()
+	ta := newTestApp(t)
+	ta.createUser("alice", "user")
+	ta.createUser("bob", "user")
+	alice, _ := ta.login("alice")
+	bob, _ := ta.login("bob")
+
+	content := []byte("same bytes uploaded twice")
+	id1, sum1 := ta.upload(alice, "a.txt", content)
+	id2, sum2 := ta.upload(bob, "b.txt", content)
+	if sum1 == "" || sum1 != sum2 {
+		t.Fatalf("sha256 %q and %q, want equal", sum1, sum2)
+	}
+
+	ctx := context.Background()
+	r1, err := ta.resources.Get(ctx, id1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := ta.resources.Get(ctx, id2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r1.StorageKey != r2.StorageKey {
+		t.Fatalf("storage keys %q and %q, want the second upload to reuse the first", r1.StorageKey, r2.StorageKey)
+	}
+	blobRefs := func() int {
+		var n int
+		if err := ta.db.QueryRow("SELECT COALESCE(SUM(ref_count),0) FROM blobs WHERE sha256=?", sum1).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := blobRefs(); n != 2 {
+		t.Fatalf("ref_count %d, want 2", n)
+	}
+
+	body := ta.expectBody(ta.do("GET", fmt.Sprintf("/api/download/%d", id2), "", nil), 200)
+	if string(body) != string(content) {
+		t.Fatalf("download %q, want %q", body, content)
+	}
+
+	// 删除一个引用后对象仍在，删除最后一个引用时对象随之删除
+	ta.expectJSON(ta.do("DELETE", fmt.Sprintf("/api/resources/%d", id1), alice, nil), 200, nil)
+	if n := blobRefs(); n != 1 {
+		t.Fatalf("ref_count %d after first delete, want 1", n)
+	}
+	if _, err := storage.Stat(ctx, r2.StorageKey); err != nil {
+		t.Fatalf("object removed while still referenced: %v", err)
+	}
+	ta.expectJSON(ta.do("DELETE", fmt.Sprintf("/api/resources/%d", id2), bob, nil), 200, nil)
+	if n := blobRefs(); n != 0 {
+		t.Fatalf("ref_count %d after last delete, want 0", n)
+	}
+	if _, err := storage.Stat(ctx, r2.StorageKey); err == nil {
+		t.Fatal("object still present after its last reference was deleted")
+	}
+}
+
+func TestResourceUpdateAndDelete(t *testing.T) {
+	t.Parallel()
+	ta := newTestApp(t)
+	ta.createUser("alice", "user")
+	ta.createUser("bob", "user")
+	alice, _ := ta.login("alice")
+	bob, _ := ta.login("bob")
+	id, _ := ta.upload(alice, "notes.txt", []byte("notes"))
+	path := fmt.Sprintf("/api/resources/%d", id)
+
+	ta.expectError(ta.do("PUT", "/api/resources/999999", alice, map[string]string{"description": "x"}), 404, "RESOURCE_NOT_FOUND")
+	ta.expectError(ta.do("DELETE", "/api/resources/999999", alice, nil), 404, "RESOURCE_NOT_FOUND")
+	ta.expectError(ta.do("PUT", path, "", map[string]string{"description": "x"}), 401, "UNAUTHORIZED")
+	ta.expectError(ta.do("PUT", path, bob, map[string]string{"description": "x"}), 403, "RESOURCE_FORBIDDEN")
+
+	// 只更新请求中出现的字段
+	ta.expectJSON(ta.do("PUT", path, alice, map[string]string{"description": "meeting notes"}), 200, nil)
+	ta.expectJSON(ta.do("PUT", path, alice, map[string]string{"visibility": "unlisted"}), 200, nil)
+	var res Resource
+	ta.expectJSON(ta.do("GET", path, alice, nil), 200, &res)
+	if res.Description != "meeting notes" || res.Visibility != "unlisted" {
+		t.Fatalf("description %q visibility %q, want meeting notes/unlisted", res.Description, res.Visibility)
+	}
+
+	ta.expectError(ta.do("DELETE", path, bob, nil), 403, "RESOURCE_FORBIDDEN")
+	ta.expectJSON(ta.do("DELETE", path, alice, nil), 200, nil)
+	ta.expectError(ta.do("DELETE", path, alice, nil), 404, "RESOURCE_NOT_FOUND")
+	ta.expectError(ta.do("PUT", path, alice, map[string]string{"description": "x"}), 404, "RESOURCE_NOT_FOUND")
+}
+
+func TestLastAdminProtected(t *testing.T) {
+	t.Parallel()
+	ta := newTestApp(t)
+	rootID := ta.createUser("root", "admin")
+	bobID := ta.createUser("bob", "user")
+	root, _ := ta.login("root")
+	rootPath := fmt.Sprintf("/api/users/%d", rootID)
+
+	ta.expectError(ta.do("PUT", rootPath, root, map[string]string{"role": "user"}), 403, "PROTECTED_USER")
+	ta.expectError(ta.do("DELETE", rootPath, root, nil), 403, "PROTECTED_USER")
+	ta.expectError(ta.do("PUT", "/api/users/999999", root, map[string]string{"role": "user"}), 404, "USER_NOT_FOUND")
+
+	// 有了第二个管理员之后可以降级
+	ta.expectJSON(ta.do("PUT", fmt.Sprintf("/api/users/%d", bobID), root, map[string]string{"role": "admin"}), 200, nil)
+	ta.expectJSON(ta.do("PUT", rootPath, root, map[string]string{"role": "user"}), 200, nil)
+	var admins int
+	if err := ta.db.QueryRow("SELECT COUNT(*) FROM users WHERE role='admin'").Scan(&admins); err != nil {
+		t.Fatal(err)
+	}
+	if admins != 1 {
+		t.Fatalf("%d admins, want 1", admins)
+	}
+}
+
+func TestUserPartialUpdate(t *testing.T) {
+	t.Parallel()
+	ta := newTestApp(t)
+	ta.createUser("root", "admin")
+	bobID := ta.createUser("bob", "user")
+	root, _ := ta.login("root")
+	bob, _ := ta.login("bob")
+	path := fmt.Sprintf("/api/users/%d", bobID)
+
+	ta.expectError(ta.do("PUT", path, root, map[string]string{"role": "superuser"}), 400, "INVALID_ROLE")
+	ta.expectError(ta.do("PUT", path, root, map[string]string{"username": "b"}), 400, "INVALID_SIGNUP")
+	ta.expectError(ta.do("PUT", path, root, []byte("{")), 400, "BAD_REQUEST")
+	ta.expectError(ta.do("POST", "/api/users", root, map[string]string{"username": "carol", "password": testPassword, "role": "owner"}),
+		400, "INVALID_ROLE")
+
+	// 只改密码时用户名和角色保持不变，已签发的令牌失效
+	ta.expectJSON(ta.do("PUT", path, root, map[string]string{"password": "another1"}), 200, nil)
+	u, err := ta.users.Get(context.Background(), bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "bob" || u.Role != "user" {
+		t.Fatalf("username %q role %q after password change, want bob/user", u.Username, u.Role)
+	}
+	ta.expectError(ta.do("GET", "/api/user", bob, nil), 401, "TOKEN_REVOKED")
+	ta.expectJSON(ta.do("POST", "/api/login", "", map[string]string{"username": "bob", "password": "another1"}), 200, nil)
+
+	ta.expectJSON(ta.do("PUT", path, root, map[string]string{"username": "robert"}), 200, nil)
+	if u, err = ta.users.Get(context.Background(), bobID); err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "robert" || u.Role != "user" {
+		t.Fatalf("username %q role %q after rename, want robert/user", u.Username, u.Role)
+	}
+	ta.expectJSON(ta.do("PUT", path, root, map[string]string{}), 200, nil)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "resapp_http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "resapp_http_request_duration_seconds",
+		Help:    "HTTP request latency by route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "status"})
+
+	uploadBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "resapp_upload_bytes_total",
+		Help: "Bytes received by completed uploads.",
+	}, []string{"mode"})
+	uploadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "resapp_upload_duration_seconds",
+		Help:    "Time from upload start to completion.",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 14),
+	}, []string{"mode"})
+	uploadsActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "resapp_uploads_active",
+		Help: "Streaming uploads currently in progress on this instance.",
+	})
+	downloadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "resapp_download_bytes_total",
+		Help: "Bytes served by /api/download (estimated from Range when delivered by nginx).",
+	})
+	jwtFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "resapp_jwt_validation_failures_total",
+		Help: "Rejected access tokens by reason (invalid, revoked).",
+	}, []string{"reason"})
+)
+
+// initMetrics 注册所有指标，包括 db 的连接池统计
+func initMetrics(db *sql.DB) {
+	prometheus.MustRegister(httpRequests, httpDuration, uploadBytes, uploadDuration,
+		uploadsActive, downloadBytes, jwtFailures,
+		collectors.NewDBStatsCollector(db, getEnv("DB_NAME", "resource_share")))
+}
+
+// handleMetrics 返回 /metrics 处理函数。METRICS_TOKEN 未设置时不对外暴露，
+// 设置后 Prometheus 需要以 Bearer 令牌抓取（scrape_config 中的 authorization）。
+func handleMetrics() http.HandlerFunc {
+	token := getEnv("METRICS_TOKEN", "")
+	if token == "" {
+		slog.Info("METRICS_TOKEN not set, /metrics disabled")
+		return http.NotFound
+	}
+	h := promhttp.Handler()
+	want := []byte("Bearer " + token)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeError(w, r, apiUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+// observeRequest 按注册时的 pattern 统计请求，避免把资源 ID 等路径参数变成标签
+func observeRequest(pattern, method string, status int, elapsed time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(pattern, method, code).Inc()
+	httpDuration.WithLabelValues(pattern, code).Observe(elapsed.Seconds())
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrations/<driver>/NNNN_name.up.sql 与对应的 .down.sql 编译进二进制，
+// 已执行的版本记录在 schema_migrations 中
+//
+//go:embed migrations
+var migrationFS embed.FS
+
+type migration struct {
+	version  int
+	name     string
+	up, down string
+}
+
+// loadMigrations 读取当前驱动的全部迁移，按版本升序返回
+func (a *App) loadMigrations() ([]migration, error) {
+	dir := path.Join("migrations", a.driver)
+	entries, err := fs.ReadDir(migrationFS, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*migration{}
+	for _, e := range entries {
+		base, ok := strings.CutSuffix(e.Name(), ".sql")
+		if !ok {
+			continue
+		}
+		base, isDown := strings.CutSuffix(base, ".down")
+		if !isDown {
+			if base, ok = strings.CutSuffix(base, ".up"); !ok {
+				return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql", e.Name())
+			}
+		}
+		num, name, _ := strings.Cut(base, "_")
+		v, err := strconv.Atoi(num)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", e.Name())
+		}
+		b, err := migrationFS.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[v]
+		if m == nil {
+			m = &migration{version: v, name: name}
+			byVersion[v] = m
+		}
+		if isDown {
+			m.down = string(b)
+		} else {
+			m.up = string(b)
+		}
+	}
+	list := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %04d_%s: missing .up.sql", m.version, m.name)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].version < list[j].version })
+	return list, nil
+}
+
+// splitStatements 按行尾的分号拆分 SQL 脚本，忽略 -- 注释行
+func splitStatements(script string) []string {
+	var stmts []string
+	var cur strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(cur.String()), ";"))
+			cur.Reset()
+		}
+	}
+	if s := strings.TrimSpace(cur.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
+
+func (a *App) ensureMigrationTable() error {
+	_, err := a.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version int NOT NULL PRIMARY KEY,
+		name varchar(255) NOT NULL,
+		applied_at timestamp NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+func (a *App) appliedMigrations() (map[int]bool, error) {
+	if err := a.ensureMigrationTable(); err != nil {
+		return nil, err
+	}
+	rows, err := a.db.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]bool{}
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+// runMigration 执行一个迁移脚本并更新 schema_migrations。MySQL 的 DDL 会隐式提交，
+// 中途失败时已执行的语句不会回滚，因此迁移脚本应尽量写成可重复执行的形式。
+func (a *App) runMigration(m migration, up bool) error {
+	script := m.down
+	if up {
+		script = m.up
+	}
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range splitStatements(script) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+		}
+	}
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_migrations (version,name) VALUES (?,?)", m.version, m.name)
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version=?", m.version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockMigrations 用 MySQL 的命名锁防止多个实例同时迁移；SQLite 只有单个进程，不需要
+func (a *App) lockMigrations() (func(), error) {
+	if a.driver != "mysql" {
+		return func() {}, nil
+	}
+	ctx := context.Background()
+	conn, err := a.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK('resapp_migrate', 60)").Scan(&got); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if got.Int64 != 1 {
+		conn.Close()
+		return nil, fmt.Errorf("timed out waiting for another instance to finish migrating")
+	}
+	return func() {
+		conn.ExecContext(ctx, "DO RELEASE_LOCK('resapp_migrate')")
+		conn.Close()
+	}, nil
+}
+
+// migrateUp 依次执行尚未应用的迁移，target 为 0 表示迁移到最新版本
+func (a *App) migrateUp(target int) (int, error) {
+	list, err := a.loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	unlock, err := a.lockMigrations()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	applied, err := a.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, m := range list {
+		if applied[m.version] || (target > 0 && m.version > target) {
+			continue
+		}
+		if err := a.runMigration(m, true); err != nil {
+			return n, err
+		}
+		slog.Info("migration applied", "version", m.version, "name", m.name)
+		n++
+	}
+	return n, nil
+}
+
+// migrateDown 按版本从高到低回滚 steps 个已应用的迁移
+func (a *App) migrateDown(steps int) (int, error) {
+	list, err := a.loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	unlock, err := a.lockMigrations()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	applied, err := a.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := len(list) - 1; i >= 0 && n < steps; i-- {
+		m := list[i]
+		if !applied[m.version] {
+			continue
+		}
+		if m.down == "" {
+			return n, fmt.Errorf("migration %04d_%s has no .down.sql", m.version, m.name)
+		}
+		if err := a.runMigration(m, false); err != nil {
+			return n, err
+		}
+		slog.Info("migration reverted", "version", m.version, "name", m.name)
+		n++
+	}
+	return n, nil
+}
+
+func (a *App) pendingMigrations() ([]migration, error) {
+	list, err := a.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := a.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var pending []migration
+	for _, m := range list {
+		if !applied[m.version] {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// prepareSchema 在服务启动时调用。AUTO_MIGRATE=false 时只检查，有未应用的迁移就拒绝启动，
+// 由运维先执行 resapp migrate up。
+func (a *App) prepareSchema() error {
+	if getEnv("AUTO_MIGRATE", "true") == "true" {
+		if _, err := a.migrateUp(0); err != nil {
+			return err
+		}
+	} else {
+		pending, err := a.pendingMigrations()
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migrations (first %04d_%s), run `resapp migrate up`",
+				len(pending), pending[0].version, pending[0].name)
+		}
+	}
+	return a.migrateStorageKeys()
+}
+
+// runMigrateCommand 实现 resapp migrate up [version] | down [steps] | status
+func runMigrateCommand(args []string) error {
+	a, err := openApp()
+	if err != nil {
+		return err
+	}
+	defer a.db.Close()
+	cmd := "up"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	arg := 0
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid argument %q", args[1])
+		}
+		arg = n
+	}
+	switch cmd {
+	case "up":
+		n, err := a.migrateUp(arg)
+		fmt.Printf("applied %d migrations\n", n)
+		return err
+	case "down":
+		if arg == 0 {
+			arg = 1
+		}
+		n, err := a.migrateDown(arg)
+		fmt.Printf("reverted %d migrations\n", n)
+		return err
+	case "status":
+		return a.printMigrationStatus(os.Stdout)
+	default:
+		return fmt.Errorf("usage: resapp migrate up [version] | down [steps] | status")
+	}
+}
+
+func (a *App) printMigrationStatus(w io.Writer) error {
+	list, err := a.loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := a.appliedMigrations()
+	if err != nil {
+		return err
+	}
+	for _, m := range list {
+		state := "pending"
+		if applied[m.version] {
+			state = "applied"
+		}
+		fmt.Fprintf(w, "%04d_%s\t%s\n", m.version, m.name, state)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+-- 初始结构，由原 mysql/init.sql 转换而来；全部使用 IF NOT EXISTS，旧库上执行也是安全的
+
+-- 先创建 users 表（被其他表引用）
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `username` varchar(50) NOT NULL,
+  `password` varchar(255) NOT NULL COMMENT 'bcrypt哈希（兼容旧版MD5加盐哈希，登录后自动升级）',
+  `role` enum('user','admin') DEFAULT 'user',
+  `token_version` int NOT NULL DEFAULT '0' COMMENT '角色或密码变更时递增，使已签发令牌失效',
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `username` (`username`),
+  KEY `idx_username` (`username`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 创建 announcements 表
+CREATE TABLE IF NOT EXISTS `announcements` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `title` varchar(200) NOT NULL,
+  `content` text,
+  `is_active` tinyint(1) DEFAULT '1',
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_active_created` (`is_active`,`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 插入示例公告（仅空表时）
+INSERT INTO `announcements` (`title`, `content`)
+SELECT '欢迎使用资源共享平台', '这是一个基于 Go + MySQL + Nginx 构建的文件分享系统，支持大文件分块上传和多种文件类型预览。'
+FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM `announcements`);
+
+-- 创建 resources 表（现在可以安全地引用 users 表）
+CREATE TABLE IF NOT EXISTS `resources` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `name` varchar(255) NOT NULL COMMENT '存储的文件名',
+  `orig_name` varchar(255) NOT NULL COMMENT '原始文件名',
+  `size` bigint NOT NULL COMMENT '文件大小(字节)',
+  `category` varchar(50) DEFAULT '其他' COMMENT '分类名称',
+  `description` text COMMENT '资源描述',
+  `file_path` varchar(500) DEFAULT NULL COMMENT '旧版本地路径，已由 storage_key 取代',
+  `storage_key` varchar(500) DEFAULT NULL COMMENT '存储后端中的对象 key',
+  `sha256` char(64) DEFAULT NULL COMMENT '文件内容 SHA-256',
+  `file_type` varchar(50) DEFAULT NULL COMMENT '文件类型',
+  `visibility` enum('public','private','unlisted') NOT NULL DEFAULT 'public' COMMENT '可见性',
+  `uploader_id` int DEFAULT NULL,
+  `downloads` int DEFAULT '0' COMMENT '下载次数',
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `uploader_id` (`uploader_id`),
+  KEY `idx_category` (`category`),
+  KEY `idx_created` (`created_at`),
+  KEY `idx_downloads` (`downloads`),
+  KEY `idx_storage_key` (`storage_key`),
+  KEY `idx_sha256` (`sha256`),
+  KEY `idx_visibility` (`visibility`),
+  FULLTEXT KEY `idx_search` (`orig_name`,`description`),
+  CONSTRAINT `resources_ibfk_2` FOREIGN KEY (`uploader_id`) REFERENCES `users` (`id`) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 创建 upload_tasks 表
+CREATE TABLE IF NOT EXISTS `upload_tasks` (
+  `id` varchar(64) NOT NULL,
+  `user_id` int DEFAULT NULL,
+  `file_name` varchar(255) DEFAULT NULL,
+  `file_size` bigint DEFAULT NULL,
+  `chunk_size` bigint DEFAULT NULL,
+  `total_chunks` int DEFAULT NULL,
+  `uploaded` text,
+  `status` varchar(20) DEFAULT 'pending',
+  `progress` int DEFAULT '0',
+  `description` text,
+  `file_path` varchar(512) DEFAULT NULL,
+  `category` varchar(50) DEFAULT NULL,
+  `resource_id` bigint DEFAULT NULL,
+  `error` text,
+  `created_at` bigint DEFAULT NULL,
+  `updated_at` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `user_id` (`user_id`),
+  KEY `status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 创建 refresh_tokens 表（仅保存令牌的 SHA-256 摘要）
+CREATE TABLE IF NOT EXISTS `refresh_tokens` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `token_hash` char(64) NOT NULL,
+  `family_id` varchar(64) NOT NULL COMMENT '同一次登录轮换产生的令牌链',
+  `expires_at` datetime NOT NULL,
+  `revoked_at` datetime DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `token_hash` (`token_hash`),
+  KEY `idx_family` (`family_id`),
+  KEY `idx_user` (`user_id`),
+  CONSTRAINT `refresh_tokens_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 创建 api_tokens 表（个人访问令牌，仅保存 SHA-256 摘要）
+CREATE TABLE IF NOT EXISTS `api_tokens` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `token_prefix` varchar(16) NOT NULL COMMENT '用于列表中识别密钥',
+  `token_hash` char(64) NOT NULL,
+  `scopes` varchar(100) NOT NULL COMMENT '逗号分隔：read,upload,admin',
+  `expires_at` datetime DEFAULT NULL,
+  `last_used_at` datetime DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `token_hash` (`token_hash`),
+  KEY `idx_user` (`user_id`),
+  CONSTRAINT `api_tokens_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 创建 blobs 表（按内容去重的存储对象及其引用计数）
+CREATE TABLE IF NOT EXISTS `blobs` (
+  `sha256` char(64) NOT NULL,
+  `storage_key` varchar(500) NOT NULL,
+  `size` bigint NOT NULL,
+  `ref_count` int NOT NULL DEFAULT '1',
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`sha256`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 创建 download_links 表（限次签名下载链接的使用计数）
+CREATE TABLE IF NOT EXISTS `download_links` (
+  `nonce` varchar(64) NOT NULL,
+  `resource_id` int NOT NULL,
+  `max_uses` int NOT NULL,
+  `uses` int NOT NULL DEFAULT '0',
+  `expires_at` datetime NOT NULL,
+  `created_by` int DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`nonce`),
+  KEY `idx_resource` (`resource_id`),
+  CONSTRAINT `download_links_ibfk_1` FOREIGN KEY (`resource_id`) REFERENCES `resources` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 创建 share_links 表（带密码、有效期和下载次数限制的分享链接）
+CREATE TABLE IF NOT EXISTS `share_links` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `slug` varchar(32) NOT NULL,
+  `resource_id` int NOT NULL,
+  `owner_id` int NOT NULL,
+  `password_hash` varchar(255) DEFAULT NULL,
+  `expires_at` datetime DEFAULT NULL,
+  `max_downloads` int NOT NULL DEFAULT '0' COMMENT '0 表示不限',
+  `downloads` int NOT NULL DEFAULT '0',
+  `revoked_at` datetime DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `slug` (`slug`),
+  KEY `idx_owner` (`owner_id`),
+  CONSTRAINT `share_links_ibfk_1` FOREIGN KEY (`resource_id`) REFERENCES `resources` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `share_links_ibfk_2` FOREIGN KEY (`owner_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 创建 share_access_log 表（分享链接访问日志）
+CREATE TABLE IF NOT EXISTS `share_access_log` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `link_id` int NOT NULL,
+  `action` varchar(16) NOT NULL,
+  `status` int NOT NULL,
+  `ip` varchar(64) NOT NULL DEFAULT '',
+  `user_agent` varchar(255) NOT NULL DEFAULT '',
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_link` (`link_id`),
+  CONSTRAINT `share_access_log_ibfk_1` FOREIGN KEY (`link_id`) REFERENCES `share_links` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 创建 download_events 表（下载明细，counted=1 的记录计入 resources.downloads）
+CREATE TABLE IF NOT EXISTS `download_events` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `resource_id` int NOT NULL,
+  `user_id` int DEFAULT NULL,
+  `client_key` varchar(64) NOT NULL COMMENT '登录用户为 u:ID，匿名为 IP+UA 摘要',
+  `ip` varchar(64) NOT NULL DEFAULT '',
+  `user_agent` varchar(255) NOT NULL DEFAULT '',
+  `range_header` varchar(128) NOT NULL DEFAULT '',
+  `bytes` bigint NOT NULL DEFAULT '0',
+  `counted` tinyint(1) NOT NULL DEFAULT '0',
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_resource_client` (`resource_id`,`client_key`,`created_at`),
+  KEY `idx_created` (`created_at`),
+  CONSTRAINT `download_events_ibfk_1` FOREIGN KEY (`resource_id`) REFERENCES `resources` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 统计汇总表，由 go-app 定期从 download_events 与 resources 重算
+CREATE TABLE IF NOT EXISTS `stats_resource_daily` (
+  `day` date NOT NULL,
+  `resource_id` int NOT NULL,
+  `downloads` int NOT NULL DEFAULT '0' COMMENT '计数下载次数',
+  `bytes` bigint NOT NULL DEFAULT '0' COMMENT '输出字节数',
+  PRIMARY KEY (`day`,`resource_id`),
+  KEY `idx_resource` (`resource_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS `stats_uploader_daily` (
+  `day` date NOT NULL,
+  `uploader_id` int NOT NULL COMMENT '0 表示上传者已删除',
+  `uploads` int NOT NULL DEFAULT '0',
+  `bytes` bigint NOT NULL DEFAULT '0',
+  PRIMARY KEY (`day`,`uploader_id`),
+  KEY `idx_uploader` (`uploader_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS `stats_storage` (
+  `category` varchar(50) NOT NULL,
+  `file_type` varchar(50) NOT NULL,
+  `files` int NOT NULL DEFAULT '0',
+  `bytes` bigint NOT NULL DEFAULT '0',
+  PRIMARY KEY (`category`,`file_type`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
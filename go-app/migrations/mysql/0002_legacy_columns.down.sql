@@ -0,0 +1 @@
+-- 0002 只补齐 0001 已定义的列，回滚时无需改动
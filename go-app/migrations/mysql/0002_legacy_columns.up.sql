@@ -0,0 +1,49 @@
+-- 补齐由旧版 init.sql 创建的库缺少的列。新库在 0001 中已经包含这些列，
+-- 因此每一步都先查 information_schema，只在缺失时执行 ALTER。
+
+SET @ddl = IF((SELECT CHARACTER_MAXIMUM_LENGTH FROM information_schema.COLUMNS
+    WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'users' AND COLUMN_NAME = 'password') < 255,
+  'ALTER TABLE `users` MODIFY `password` varchar(255) NOT NULL',
+  'DO 0');
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @ddl = IF(NOT EXISTS (SELECT 1 FROM information_schema.COLUMNS
+    WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'users' AND COLUMN_NAME = 'token_version'),
+  'ALTER TABLE `users` ADD COLUMN `token_version` int NOT NULL DEFAULT ''0'' AFTER `role`',
+  'DO 0');
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @ddl = IF(NOT EXISTS (SELECT 1 FROM information_schema.COLUMNS
+    WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'resources' AND COLUMN_NAME = 'storage_key'),
+  'ALTER TABLE `resources`
+    ADD COLUMN `storage_key` varchar(500) DEFAULT NULL COMMENT ''存储后端中的对象 key'' AFTER `file_path`,
+    MODIFY `file_path` varchar(500) DEFAULT NULL COMMENT ''旧版本地路径，已由 storage_key 取代'',
+    ADD KEY `idx_storage_key` (`storage_key`)',
+  'DO 0');
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @ddl = IF(NOT EXISTS (SELECT 1 FROM information_schema.COLUMNS
+    WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'resources' AND COLUMN_NAME = 'sha256'),
+  'ALTER TABLE `resources`
+    ADD COLUMN `sha256` char(64) DEFAULT NULL COMMENT ''文件内容 SHA-256'' AFTER `storage_key`,
+    ADD KEY `idx_sha256` (`sha256`)',
+  'DO 0');
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @ddl = IF(NOT EXISTS (SELECT 1 FROM information_schema.COLUMNS
+    WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'resources' AND COLUMN_NAME = 'visibility'),
+  'ALTER TABLE `resources`
+    ADD COLUMN `visibility` enum(''public'',''private'',''unlisted'') NOT NULL DEFAULT ''public'' AFTER `file_type`,
+    ADD KEY `idx_visibility` (`visibility`)',
+  'DO 0');
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
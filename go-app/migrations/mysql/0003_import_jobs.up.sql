@@ -0,0 +1,33 @@
+-- 目录批量导入：每个任务一行，逐个文件的处理结果记录在 import_items 中，中断后据此续传
+
+CREATE TABLE IF NOT EXISTS `import_jobs` (
+  `id` varchar(64) NOT NULL,
+  `root` varchar(1024) NOT NULL COMMENT '导入的目录（绝对路径）',
+  `mode` varchar(8) NOT NULL DEFAULT 'copy' COMMENT 'copy 或 link（硬链接）',
+  `visibility` varchar(16) NOT NULL DEFAULT 'public',
+  `description` text COMMENT '没有说明文件和子目录时使用的描述',
+  `uploader_id` int DEFAULT NULL,
+  `status` varchar(20) NOT NULL DEFAULT 'running' COMMENT 'running/completed/failed',
+  `total_files` int NOT NULL DEFAULT '0',
+  `total_bytes` bigint NOT NULL DEFAULT '0',
+  `imported` int NOT NULL DEFAULT '0',
+  `skipped` int NOT NULL DEFAULT '0',
+  `failed` int NOT NULL DEFAULT '0',
+  `error` text,
+  `created_at` bigint NOT NULL,
+  `updated_at` bigint NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS `import_items` (
+  `job_id` varchar(64) NOT NULL,
+  `path_hash` char(64) NOT NULL COMMENT '相对路径的 SHA-256，路径本身太长不能做主键',
+  `path` varchar(1024) NOT NULL COMMENT '相对 root 的路径',
+  `status` varchar(16) NOT NULL COMMENT 'imported/skipped/failed',
+  `resource_id` int DEFAULT NULL,
+  `error` text,
+  `updated_at` bigint NOT NULL,
+  PRIMARY KEY (`job_id`,`path_hash`),
+  CONSTRAINT `import_items_ibfk_1` FOREIGN KEY (`job_id`) REFERENCES `import_jobs` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
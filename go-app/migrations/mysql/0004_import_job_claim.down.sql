@@ -0,0 +1 @@
+ALTER TABLE `import_jobs` DROP COLUMN `owner`, DROP COLUMN `heartbeat`;
@@ -0,0 +1,6 @@
+-- 导入任务由执行者在数据库中认领：owner 标识当前执行者，heartbeat 定期刷新，
+-- 心跳超时的 running 任务视为执行者已退出，可以被其他进程接手
+
+ALTER TABLE `import_jobs`
+  ADD COLUMN `owner` varchar(64) DEFAULT NULL COMMENT '正在执行该任务的进程',
+  ADD COLUMN `heartbeat` bigint NOT NULL DEFAULT '0' COMMENT '执行者最近一次心跳的 Unix 时间';
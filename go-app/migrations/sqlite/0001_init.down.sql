@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS download_events;
+DROP TABLE IF EXISTS share_access_log;
+DROP TABLE IF EXISTS share_links;
+DROP TABLE IF EXISTS download_links;
+DROP TABLE IF EXISTS blobs;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS upload_tasks;
+DROP TABLE IF EXISTS resources;
+DROP TABLE IF EXISTS announcements;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1 @@
+-- 空迁移，见 0002_legacy_columns.up.sql
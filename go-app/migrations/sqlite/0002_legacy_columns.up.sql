@@ -0,0 +1,2 @@
+-- MySQL 的 0002 为旧版 init.sql 创建的库补齐缺失的列。SQLite 没有旧版库，0001 已经包含这些列，
+-- 这里保留空迁移，使两种驱动的版本号对应同一个 schema
@@ -0,0 +1,31 @@
+-- 目录批量导入任务及逐个文件的处理结果，与 MySQL 的 0003 对应
+
+CREATE TABLE IF NOT EXISTS import_jobs (
+  id TEXT PRIMARY KEY,
+  root TEXT NOT NULL,
+  mode TEXT NOT NULL DEFAULT 'copy',
+  visibility TEXT NOT NULL DEFAULT 'public',
+  description TEXT,
+  uploader_id INTEGER,
+  status TEXT NOT NULL DEFAULT 'running',
+  total_files INTEGER NOT NULL DEFAULT 0,
+  total_bytes INTEGER NOT NULL DEFAULT 0,
+  imported INTEGER NOT NULL DEFAULT 0,
+  skipped INTEGER NOT NULL DEFAULT 0,
+  failed INTEGER NOT NULL DEFAULT 0,
+  error TEXT,
+  created_at INTEGER NOT NULL,
+  updated_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_import_jobs_status ON import_jobs (status);
+
+CREATE TABLE IF NOT EXISTS import_items (
+  job_id TEXT NOT NULL REFERENCES import_jobs (id) ON DELETE CASCADE,
+  path_hash TEXT NOT NULL,
+  path TEXT NOT NULL,
+  status TEXT NOT NULL,
+  resource_id INTEGER,
+  error TEXT,
+  updated_at INTEGER NOT NULL,
+  PRIMARY KEY (job_id, path_hash)
+);
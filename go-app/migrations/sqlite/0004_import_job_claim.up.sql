@@ -0,0 +1,4 @@
+-- 导入任务的认领与心跳，与 MySQL 的 0004 对应
+
+ALTER TABLE import_jobs ADD COLUMN owner TEXT;
+ALTER TABLE import_jobs ADD COLUMN heartbeat INTEGER NOT NULL DEFAULT 0;
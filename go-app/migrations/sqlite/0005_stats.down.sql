@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS stats_storage;
+DROP TABLE IF EXISTS stats_uploader_daily;
+DROP TABLE IF EXISTS stats_resource_daily;
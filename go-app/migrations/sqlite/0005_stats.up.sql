@@ -0,0 +1,29 @@
+-- 统计汇总表，与 MySQL 0001 中的同名表对应；day 保存为 YYYY-MM-DD 文本
+
+CREATE TABLE IF NOT EXISTS stats_resource_daily (
+  day DATE NOT NULL,
+  resource_id INTEGER NOT NULL,
+  downloads INTEGER NOT NULL DEFAULT 0,
+  bytes INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (day,resource_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stats_resource_daily_resource ON stats_resource_daily (resource_id);
+
+CREATE TABLE IF NOT EXISTS stats_uploader_daily (
+  day DATE NOT NULL,
+  uploader_id INTEGER NOT NULL,
+  uploads INTEGER NOT NULL DEFAULT 0,
+  bytes INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (day,uploader_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stats_uploader_daily_uploader ON stats_uploader_daily (uploader_id);
+
+CREATE TABLE IF NOT EXISTS stats_storage (
+  category TEXT NOT NULL,
+  file_type TEXT NOT NULL,
+  files INTEGER NOT NULL DEFAULT 0,
+  bytes INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (category,file_type)
+);
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 密码哈希格式：
+//   - $2a$/$2b$ 开头：bcrypt，自带版本、cost 与每用户随机盐
+//   - 32 位十六进制：旧版 MD5 + 全局盐，仅用于登录时校验并升级
+const passwordCost = 12
+
+func hashPassword(p string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(p), passwordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(h), nil
+}
+
+func legacyHashPassword(p string) string {
+	h := md5.Sum([]byte(p + "salt_resource_share"))
+	return hex.EncodeToString(h[:])
+}
+
+func isLegacyHash(h string) bool {
+	if len(h) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(h)
+	return err == nil
+}
+
+// verifyPassword 校验密码，needsRehash 表示哈希格式或 cost 已过时，应在登录成功后重新写入
+func verifyPassword(hash, p string) (ok, needsRehash bool) {
+	if isLegacyHash(hash) {
+		ok = subtle.ConstantTimeCompare([]byte(strings.ToLower(hash)), []byte(legacyHashPassword(p))) == 1
+		return ok, ok
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(p)) != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, err != nil || cost != passwordCost
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Principal 是经过 authMiddleware 认证的调用者
+type Principal struct {
+	UserID int
+	Role   string
+}
+
+func (p Principal) IsAdmin() bool {
+	return p.Role == "admin"
+}
+
+func principalFromRequest(r *http.Request) Principal {
+	uid, _ := strconv.Atoi(r.Header.Get("X-User-ID"))
+	return Principal{UserID: uid, Role: r.Header.Get("X-User-Role")}
+}
+
+// canModify 是所有“拥有者或管理员”类操作的统一授权判断。
+// ownerID 为 0 表示记录没有拥有者（例如上传者已被删除），此时只有管理员可以操作。
+func canModify(p Principal, ownerID int) bool {
+	if p.UserID == 0 {
+		return false
+	}
+	return p.IsAdmin() || ownerID == p.UserID
+}
+
+// optionalAuth 在携带令牌时按 authMiddleware 认证，否则以匿名身份继续
+func (a *App) optionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	protected := a.authMiddleware(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			r.Header.Del("X-User-ID")
+			r.Header.Del("X-User-Role")
+			r.Header.Del("X-Token-Scopes")
+			next(w, r)
+			return
+		}
+		protected(w, r)
+	}
+}
+
+// authMutations 对只读请求放行（携带令牌时仍会识别身份），其余方法要求登录
+func (a *App) authMutations(next http.HandlerFunc) http.HandlerFunc {
+	optional := a.optionalAuth(next)
+	protected := a.authMiddleware(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" || r.Method == "HEAD" {
+			optional(w, r)
+			return
+		}
+		protected(w, r)
+	}
+}
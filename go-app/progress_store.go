@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	progressActiveTTL = time.Hour       // 上传进行中，每次写入都会续期
+	progressDoneTTL   = 5 * time.Minute // 完成或失败后保留一段时间供客户端读取最终状态
+)
+
+var ErrProgressNotFound = errors.New("upload progress not found")
+
+// ProgressStore 保存上传进度快照。每个上传只有一个写入者（处理该请求的实例），
+// 其他实例通过 Get 读取、通过 Subscribe 接收变更通知，因此多个 go-app 可以共享进度。
+type ProgressStore interface {
+	Put(ctx context.Context, id string, p *UploadProgress, ttl time.Duration) error
+	Get(ctx context.Context, id string) (*UploadProgress, error)
+	// Subscribe 返回的通道在进度变化时收到信号，取消函数必须调用以释放订阅
+	Subscribe(ctx context.Context, id string) (<-chan struct{}, func())
+}
+
+var progressStore ProgressStore
+
+func initProgressStore() error {
+	switch driver := getEnv("PROGRESS_STORE", "memory"); driver {
+	case "memory":
+		progressStore = NewMemoryProgressStore()
+	case "redis":
+		s, err := newRedisProgressStore()
+		if err != nil {
+			return err
+		}
+		progressStore = s
+	default:
+		return fmt.Errorf("unknown PROGRESS_STORE %q", driver)
+	}
+	return nil
+}
+
+// MemoryProgressStore 是单实例部署的默认实现，过期条目由后台协程定期清理
+type MemoryProgressStore struct {
+	mu      sync.RWMutex
+	entries map[string]memoryProgress
+	subs    map[string]map[chan struct{}]struct{}
+}
+
+type memoryProgress struct {
+	p       UploadProgress
+	expires time.Time
+}
+
+func NewMemoryProgressStore() *MemoryProgressStore {
+	s := &MemoryProgressStore{
+		entries: make(map[string]memoryProgress),
+		subs:    make(map[string]map[chan struct{}]struct{}),
+	}
+	go s.janitor(time.Minute)
+	return s
+}
+
+func (s *MemoryProgressStore) janitor(every time.Duration) {
+	for range time.Tick(every) {
+		now := time.Now()
+		s.mu.Lock()
+		for id, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, id)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *MemoryProgressStore) Put(ctx context.Context, id string, p *UploadProgress, ttl time.Duration) error {
+	s.mu.Lock()
+	s.entries[id] = memoryProgress{p: *p, expires: time.Now().Add(ttl)}
+	// 通知只是一个信号，订阅者自行读取最新快照，慢客户端不会阻塞上传
+	for ch := range s.subs[id] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryProgressStore) Get(ctx context.Context, id string) (*UploadProgress, error) {
+	s.mu.RLock()
+	e, ok := s.entries[id]
+	s.mu.RUnlock()
+	if !ok || time.Now().After(e.expires) {
+		return nil, ErrProgressNotFound
+	}
+	return &e.p, nil
+}
+
+func (s *MemoryProgressStore) Subscribe(ctx context.Context, id string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	s.mu.Lock()
+	if s.subs[id] == nil {
+		s.subs[id] = make(map[chan struct{}]struct{})
+	}
+	s.subs[id][ch] = struct{}{}
+	s.mu.Unlock()
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subs[id], ch)
+		if len(s.subs[id]) == 0 {
+			delete(s.subs, id)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// progressTracker 由上传处理函数持有，负责计算瞬时速度并按 progressInterval 节流写入 progressStore
+type progressTracker struct {
+	id         string
+	mode       string // 指标的 mode 标签：stream 或 import
+	mu         sync.Mutex
+	p          UploadProgress
+	lastSample time.Time
+	lastBytes  int64
+	finished   bool
+}
+
+func newProgressTracker(id, fileName string, total int64) *progressTracker {
+	t := &progressTracker{id: id, mode: "stream", p: UploadProgress{
+		TotalSize: total,
+		StartTime: time.Now(),
+		FileName:  fileName,
+		Status:    "uploading",
+	}}
+	t.lastSample = t.p.StartTime
+	t.save(progressActiveTTL)
+	uploadsActive.Inc()
+	return t
+}
+
+func (t *progressTracker) save(ttl time.Duration) {
+	// 使用独立的 context：客户端断开导致请求取消时仍要记录失败状态
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := progressStore.Put(ctx, t.id, &t.p, ttl); err != nil {
+		slog.Warn("progress store write failed", "upload_id", t.id, "err", err)
+	}
+}
+
+// update 在 ProgressReader 回调中调用；每 progressInterval 计算一次瞬时速度（指数平滑）并写入存储。
+// 命令行导入不记录进度，传入的 tracker 为 nil。
+func (t *progressTracker) update(read int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.Uploaded = read
+	now := time.Now()
+	dt := now.Sub(t.lastSample)
+	if dt < progressInterval {
+		return
+	}
+	inst := float64(read-t.lastBytes) / dt.Seconds()
+	if t.p.Speed == 0 {
+		t.p.Speed = inst
+	} else {
+		t.p.Speed = speedSmoothing*inst + (1-speedSmoothing)*t.p.Speed
+	}
+	t.lastSample, t.lastBytes = now, read
+	t.save(progressActiveTTL)
+}
+
+func (t *progressTracker) fail(msg string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.Status = "error"
+	t.p.ErrorMessage = msg
+	t.save(progressDoneTTL)
+	t.finish()
+}
+
+func (t *progressTracker) complete(size int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.Status = "completed"
+	t.p.Uploaded = size
+	t.p.TotalSize = size
+	t.save(progressDoneTTL)
+	if t.finish() {
+		uploadBytes.WithLabelValues(t.mode).Add(float64(size))
+		uploadDuration.WithLabelValues(t.mode).Observe(time.Since(t.p.StartTime).Seconds())
+	}
+}
+
+// finish 只在第一次调用时减少活跃上传数，返回是否为第一次
+func (t *progressTracker) finish() bool {
+	if t.finished {
+		return false
+	}
+	t.finished = true
+	uploadsActive.Dec()
+	return true
+}
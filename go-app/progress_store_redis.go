@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisProgressStore 让多个 go-app 实例共享进度：快照保存为带过期时间的 JSON，
+// 每次写入同时 PUBLISH 到同名频道，SSE 订阅者据此得到通知。
+type RedisProgressStore struct {
+	Client redis.UniversalClient
+	Prefix string
+}
+
+func newRedisProgressStore() (*RedisProgressStore, error) {
+	dbIndex, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
+	client := redis.NewClient(&redis.Options{
+		Addr:     getEnv("REDIS_ADDR", "redis:6379"),
+		Password: getEnv("REDIS_PASSWORD", ""),
+		DB:       dbIndex,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+	return &RedisProgressStore{Client: client, Prefix: "resapp:progress:"}, nil
+}
+
+func (s *RedisProgressStore) Put(ctx context.Context, id string, p *UploadProgress, ttl time.Duration) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	pipe := s.Client.TxPipeline()
+	pipe.Set(ctx, s.Prefix+id, b, ttl)
+	pipe.Publish(ctx, s.Prefix+id, "1")
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisProgressStore) Get(ctx context.Context, id string) (*UploadProgress, error) {
+	b, err := s.Client.Get(ctx, s.Prefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrProgressNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var p UploadProgress
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *RedisProgressStore) Subscribe(ctx context.Context, id string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	sub := s.Client.Subscribe(ctx, s.Prefix+id)
+	go func() {
+		for range sub.Channel() {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return ch, func() { sub.Close() }
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisStore(t *testing.T) (*RedisProgressStore, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return &RedisProgressStore{Client: client, Prefix: "test:progress:"}, mr
+}
+
+func TestRedisProgressStorePutGet(t *testing.T) {
+	t.Parallel()
+	s, mr := newTestRedisStore(t)
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, "missing"); err != ErrProgressNotFound {
+		t.Fatalf("Get missing: %v, want ErrProgressNotFound", err)
+	}
+	want := &UploadProgress{TotalSize: 100, Uploaded: 40, FileName: "a.bin", Status: "uploading"}
+	if err := s.Put(ctx, "u1", want, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TotalSize != 100 || got.Uploaded != 40 || got.FileName != "a.bin" || got.Status != "uploading" {
+		t.Fatalf("Get returned %+v, want %+v", got, want)
+	}
+
+	// 快照按 Put 传入的 TTL 过期
+	if ttl := mr.TTL("test:progress:u1"); ttl != time.Minute {
+		t.Fatalf("ttl %v, want 1m", ttl)
+	}
+	mr.FastForward(time.Minute + time.Second)
+	if _, err := s.Get(ctx, "u1"); err != ErrProgressNotFound {
+		t.Fatalf("Get after ttl: %v, want ErrProgressNotFound", err)
+	}
+}
+
+func TestRedisProgressStoreSubscribe(t *testing.T) {
+	t.Parallel()
+	s, _ := newTestRedisStore(t)
+	ctx := context.Background()
+
+	ch, cancel := s.Subscribe(ctx, "u2")
+	defer cancel()
+	// SUBSCRIBE 是异步生效的，重复写入直到收到通知
+	deadline := time.After(5 * time.Second)
+	tick := time.NewTicker(20 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		if err := s.Put(ctx, "u2", &UploadProgress{Status: "uploading"}, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-ch:
+			return
+		case <-tick.C:
+		case <-deadline:
+			t.Fatal("no notification after Put")
+		}
+	}
+}
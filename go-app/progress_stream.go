@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	progressInterval  = 250 * time.Millisecond
+	progressHeartbeat = 15 * time.Second
+	speedSmoothing    = 0.3
+)
+
+func (p *UploadProgress) snapshot(id string) map[string]interface{} {
+	percent := 0.0
+	if p.TotalSize > 0 {
+		percent = float64(p.Uploaded) / float64(p.TotalSize) * 100
+	}
+	eta := -1.0
+	if p.Status == "completed" {
+		eta = 0
+	} else if p.Speed > 0 && p.TotalSize > p.Uploaded {
+		eta = float64(p.TotalSize-p.Uploaded) / p.Speed
+	}
+	return map[string]interface{}{
+		"upload_id":     id,
+		"total_size":    p.TotalSize,
+		"uploaded":      p.Uploaded,
+		"progress":      percent,
+		"speed":         p.Speed,
+		"eta":           eta,
+		"status":        p.Status,
+		"file_name":     p.FileName,
+		"error_message": p.ErrorMessage,
+		"elapsed_time":  time.Since(p.StartTime).Seconds(),
+	}
+}
+
+// sseTokenFromQuery 允许 EventSource（无法设置请求头）通过 ?access_token= 传递令牌
+func sseTokenFromQuery(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/stream") && r.Header.Get("Authorization") == "" {
+			if t := r.URL.Query().Get("access_token"); t != "" {
+				r.Header.Set("Authorization", "Bearer "+t)
+			}
+		}
+		next(w, r)
+	}
+}
+
+// handleUploadProgressStream 以 Server-Sent Events 推送 /api/upload/progress/{id}/stream
+func handleUploadProgressStream(w http.ResponseWriter, r *http.Request, uploadID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, apiStreamUnsupported)
+		return
+	}
+	ch, unsubscribe := progressStore.Subscribe(r.Context(), uploadID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	// 上传可能在客户端连上之前就已创建，也可能稍后才开始，因此先等待进度出现
+	heartbeat := time.NewTicker(progressHeartbeat)
+	defer heartbeat.Stop()
+	deadline := time.After(time.Minute)
+	for {
+		p, err := progressStore.Get(r.Context(), uploadID)
+		if err == nil {
+			data := p.snapshot(uploadID)
+			event := "progress"
+			switch data["status"] {
+			case "completed":
+				event = "done"
+			case "error":
+				event = "error"
+			}
+			b, _ := json.Marshal(data)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+			flusher.Flush()
+			if event != "progress" {
+				return
+			}
+			deadline = nil
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ch:
+			// 限制推送频率，合并 progressInterval 内的多次通知
+			time.Sleep(progressInterval)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-deadline:
+			fmt.Fprint(w, "event: error\ndata: {\"error\":\"upload not found\"}\n\n")
+			flusher.Flush()
+			return
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 对账任务比较存储中的对象与 resources/blobs 记录，找出：
+//
+//	orphan_objects       存储中没有任何记录引用的对象（上传中途失败、删除记录后删文件失败）
+//	stale_temp_files     LocalStorage.Put 残留的 .upload-*
+//	stale_chunk_uploads  chunkDir 中任务已不存在、已完成、已取消，或超过 CHUNK_UPLOAD_TTL 没有进展的分块目录
+//	multipart_temp_files 系统临时目录中的 multipart-*（旧版 ParseMultipartForm 可能留下）
+//	dangling_resources   storage_key 为空或对象已不存在的资源记录
+//
+// 文件只会被移入隔离区，不会直接删除；确认无误后由运维手动清理。系统临时目录由其他进程共用，
+// multipart-* 只报告不移动。记录只报告不修改，可以从隔离区或备份恢复对象，
+// 也可以用 resapp resource delete 删除。
+var (
+	reconcileInterval = getEnvDuration("RECONCILE_INTERVAL", 0)
+	// 修改时间在 RECONCILE_GRACE 之内的文件视为可能仍在写入，不做处理
+	reconcileGrace = getEnvDuration("RECONCILE_GRACE", time.Hour)
+)
+
+// 隔离区位于存储和 chunkDir 各自的根目录下，以 "." 开头，不会被再次扫描
+const quarantinePrefix = ".quarantine"
+
+// reconcileMu 保证同一实例上同时只有一次对账
+var reconcileMu sync.Mutex
+
+type reconcileFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+type danglingResource struct {
+	ID         int    `json:"id"`
+	OrigName   string `json:"orig_name"`
+	StorageKey string `json:"storage_key"`
+}
+
+type reconcileReport struct {
+	DryRun            bool               `json:"dry_run"`
+	Quarantine        string             `json:"quarantine,omitempty"`
+	OrphanObjects     []reconcileFile    `json:"orphan_objects"`
+	StaleTempFiles    []reconcileFile    `json:"stale_temp_files"`
+	StaleChunkUploads []reconcileFile    `json:"stale_chunk_uploads"`
+	MultipartTemp     []reconcileFile    `json:"multipart_temp_files"`
+	DanglingResources []danglingResource `json:"dangling_resources"`
+	Quarantined       int                `json:"quarantined"`
+	Errors            []string           `json:"errors"`
+}
+
+func (a *App) reconcileLoop() {
+	dryRun := getEnv("RECONCILE_DRY_RUN", "false") == "true"
+	for {
+		time.Sleep(reconcileInterval)
+		rep, err := a.reconcile(context.Background(), dryRun)
+		if err != nil {
+			slog.Error("reconcile failed", "err", err)
+			continue
+		}
+		rep.log()
+	}
+}
+
+func (rep *reconcileReport) log() {
+	slog.Info("reconcile finished", "dry_run", rep.DryRun, "orphan_objects", len(rep.OrphanObjects),
+		"stale_temp_files", len(rep.StaleTempFiles), "stale_chunk_uploads", len(rep.StaleChunkUploads),
+		"multipart_temp_files", len(rep.MultipartTemp),
+		"dangling_resources", len(rep.DanglingResources), "quarantined", rep.Quarantined,
+		"quarantine", rep.Quarantine, "errors", len(rep.Errors))
+}
+
+var errReconcileRunning = errors.New("reconcile already running")
+
+// reconcile 扫描并生成报告；dryRun 为 false 时把发现的文件移入本次的隔离目录
+func (a *App) reconcile(ctx context.Context, dryRun bool) (*reconcileReport, error) {
+	if !reconcileMu.TryLock() {
+		return nil, errReconcileRunning
+	}
+	defer reconcileMu.Unlock()
+
+	rep := &reconcileReport{
+		DryRun: dryRun, OrphanObjects: []reconcileFile{}, StaleTempFiles: []reconcileFile{},
+		StaleChunkUploads: []reconcileFile{}, MultipartTemp: []reconcileFile{}, DanglingResources: []danglingResource{}, Errors: []string{},
+	}
+	if !dryRun {
+		rep.Quarantine = path.Join(quarantinePrefix, time.Now().Format("20060102-150405"))
+	}
+	cutoff := time.Now().Add(-reconcileGrace)
+
+	// 先遍历存储再读取引用：遍历期间上传完成的对象会出现在之后读取的引用中
+	objects, listed, err := listObjects(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	referenced, err := a.referencedKeys(ctx, rep)
+	if err != nil {
+		return nil, err
+	}
+	if listed {
+		a.quarantineObjects(ctx, objects, referenced, rep)
+	} else {
+		rep.Errors = append(rep.Errors, "storage driver cannot list objects, orphan check skipped")
+	}
+	if err := a.scanChunkDirs(ctx, cutoff, rep); err != nil {
+		return nil, err
+	}
+	scanMultipartTemp(cutoff, rep)
+	return rep, nil
+}
+
+// referencedKeys 收集 resources 和 blobs 引用的全部 key，同时检查资源记录对应的对象是否存在
+func (a *App) referencedKeys(ctx context.Context, rep *reconcileReport) (map[string]bool, error) {
+	keys := map[string]bool{}
+	rows, err := a.db.QueryContext(ctx, "SELECT storage_key FROM blobs")
+	if err != nil {
+		return nil, dbError(err)
+	}
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			rows.Close()
+			return nil, dbError(err)
+		}
+		keys[k] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	rows, err = a.db.QueryContext(ctx, "SELECT id,orig_name,COALESCE(storage_key,'') FROM resources ORDER BY id")
+	if err != nil {
+		return nil, dbError(err)
+	}
+	var list []danglingResource
+	for rows.Next() {
+		var r danglingResource
+		if err := rows.Scan(&r.ID, &r.OrigName, &r.StorageKey); err != nil {
+			rows.Close()
+			return nil, dbError(err)
+		}
+		list = append(list, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	for _, r := range list {
+		if r.StorageKey != "" {
+			keys[r.StorageKey] = true
+			_, err := storage.Stat(ctx, r.StorageKey)
+			if err == nil {
+				continue
+			} else if !errors.Is(err, ErrObjectNotFound) {
+				rep.Errors = append(rep.Errors, fmt.Sprintf("stat %s: %v", r.StorageKey, err))
+				continue
+			}
+		}
+		rep.DanglingResources = append(rep.DanglingResources, r)
+	}
+	return keys, nil
+}
+
+// listObjects 列出存储中修改时间早于 cutoff 的对象；存储不支持枚举时 listed 为 false
+func listObjects(ctx context.Context, cutoff time.Time) (objects []reconcileFile, listed bool, err error) {
+	lister, ok := storage.(ObjectLister)
+	if !ok {
+		return nil, false, nil
+	}
+	err = lister.Walk(ctx, func(key string, info ObjectInfo) error {
+		if !info.ModTime.After(cutoff) {
+			objects = append(objects, reconcileFile{Path: key, Size: info.Size, ModTime: info.ModTime})
+		}
+		return nil
+	})
+	return objects, true, err
+}
+
+// quarantineObjects 找出没有被引用的对象和残留的 .upload-* 临时文件并移入隔离区。
+// 引用快照之后也可能有新记录指向某个对象（秒传、导入），移动前逐个重新查询。
+func (a *App) quarantineObjects(ctx context.Context, objects []reconcileFile, referenced map[string]bool, rep *reconcileReport) {
+	var candidates []reconcileFile
+	for _, f := range objects {
+		if strings.HasPrefix(path.Base(f.Path), ".upload-") {
+			rep.StaleTempFiles = append(rep.StaleTempFiles, f)
+		} else if !referenced[f.Path] {
+			rep.OrphanObjects = append(rep.OrphanObjects, f)
+		} else {
+			continue
+		}
+		candidates = append(candidates, f)
+	}
+	if rep.DryRun {
+		return
+	}
+	for _, f := range candidates {
+		if used, err := a.keyReferenced(ctx, f.Path); err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("check %s: %v", f.Path, err))
+			continue
+		} else if used {
+			continue
+		}
+		if err := quarantineObject(ctx, f.Path, path.Join(rep.Quarantine, f.Path)); err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("quarantine %s: %v", f.Path, err))
+			continue
+		}
+		rep.Quarantined++
+	}
+}
+
+// keyReferenced 查询 blobs 或 resources 当前是否引用 key
+func (a *App) keyReferenced(ctx context.Context, key string) (bool, error) {
+	var n int
+	err := a.db.QueryRowContext(ctx, `SELECT (SELECT COUNT(*) FROM blobs WHERE storage_key=?)
+		+ (SELECT COUNT(*) FROM resources WHERE storage_key=?)`, key, key).Scan(&n)
+	return n > 0, dbError(err)
+}
+
+func quarantineObject(ctx context.Context, key, dst string) error {
+	if m, ok := storage.(ObjectMover); ok {
+		return m.Move(ctx, key, dst)
+	}
+	body, err := storage.Get(ctx, key, 0, -1)
+	if err != nil {
+		return err
+	}
+	_, err = storage.Put(ctx, dst, body, -1)
+	body.Close()
+	if err != nil {
+		return err
+	}
+	return storage.Delete(ctx, key)
+}
+
+// scanChunkDirs 找出 chunkDir 中不再需要的分块目录：任务记录已不存在、已完成或已取消，
+// 或者未完成的任务超过 CHUNK_UPLOAD_TTL 没有更新（客户端已放弃，gc 也会删除这类任务）。
+// serve 不会自动运行 gc，这里保证放弃的上传不会一直占用磁盘；任务记录仍留给 gc 删除。
+func (a *App) scanChunkDirs(ctx context.Context, cutoff time.Time, rep *reconcileReport) error {
+	abandoned := time.Now().Add(-chunkUploadTTL).Unix()
+	entries, err := os.ReadDir(chunkDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil || fi.ModTime().After(cutoff) {
+			continue
+		}
+		var status string
+		var updated int64
+		err = dbError(a.db.QueryRowContext(ctx, "SELECT COALESCE(status,''),COALESCE(updated_at,created_at,0) FROM upload_tasks WHERE id=?",
+			e.Name()).Scan(&status, &updated))
+		switch {
+		case errors.Is(err, ErrNotFound):
+		case err != nil:
+			return err
+		case status != "completed" && status != "cancelled" && updated >= abandoned:
+			continue
+		}
+		dir := filepath.Join(chunkDir, e.Name())
+		rep.StaleChunkUploads = append(rep.StaleChunkUploads, reconcileFile{Path: e.Name(), Size: dirSize(dir), ModTime: fi.ModTime()})
+		if rep.DryRun {
+			continue
+		}
+		if err := moveLocal(dir, filepath.Join(chunkDir, filepath.FromSlash(rep.Quarantine), e.Name())); err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("quarantine chunks %s: %v", e.Name(), err))
+			continue
+		}
+		rep.Quarantined++
+	}
+	return nil
+}
+
+// scanMultipartTemp 报告 mime/multipart 在系统临时目录留下的 multipart-* 文件。
+// 临时目录由所有进程共用，无法确定文件属于本服务，因此只报告不移动。
+func scanMultipartTemp(cutoff time.Time, rep *reconcileReport) {
+	tmp := os.TempDir()
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		rep.Errors = append(rep.Errors, fmt.Sprintf("read %s: %v", tmp, err))
+		return
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !strings.HasPrefix(e.Name(), "multipart-") {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil || fi.ModTime().After(cutoff) {
+			continue
+		}
+		rep.MultipartTemp = append(rep.MultipartTemp, reconcileFile{Path: filepath.Join(tmp, e.Name()), Size: fi.Size(), ModTime: fi.ModTime()})
+	}
+}
+
+// moveLocal 重命名文件或目录；跨文件系统时对普通文件退回到复制后删除
+func moveLocal(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	fi, serr := os.Stat(src)
+	if serr != nil || !fi.Mode().IsRegular() {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+func dirSize(dir string) int64 {
+	var n int64
+	filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if fi, err := d.Info(); err == nil {
+				n += fi.Size()
+			}
+		}
+		return nil
+	})
+	return n
+}
+
+// handleReconcile: GET 只生成报告（dry-run），POST 同时把发现的文件移入隔离区
+func (a *App) handleReconcile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		writeError(w, r, apiMethodNotAllowed)
+		return
+	}
+	rep, err := a.reconcile(r.Context(), r.Method == "GET")
+	if errors.Is(err, errReconcileRunning) {
+		writeError(w, r, apiReconcileRunning)
+		return
+	} else if err != nil {
+		writeError(w, r, apiInternal.Wrap(err))
+		return
+	}
+	reqLogger(r).Info("reconcile requested", "dry_run", rep.DryRun, "quarantined", rep.Quarantined)
+	jsonResponse(w, rep)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScanChunkDirsAbandoned(t *testing.T) {
+	t.Parallel()
+	ta := newTestApp(t)
+	ta.createUser("alice", "user")
+	alice, _ := ta.login("alice")
+	content := bytes.Repeat([]byte("x"), minChunkSize+10)
+	active := initChunkTask(ta, alice, content)
+	abandoned := initChunkTask(ta, alice, content)
+
+	// 两个目录都早于宽限期，只有超过 CHUNK_UPLOAD_TTL 没有更新的任务被隔离
+	old := time.Now().Add(-2 * reconcileGrace)
+	for _, id := range []string{active, abandoned} {
+		if err := os.Chtimes(filepath.Join(chunkDir, id), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ta.db.Exec("UPDATE upload_tasks SET updated_at=? WHERE id=?",
+		time.Now().Add(-chunkUploadTTL-time.Minute).Unix(), abandoned); err != nil {
+		t.Fatal(err)
+	}
+
+	rep := &reconcileReport{Quarantine: filepath.Join(quarantinePrefix, "test-"+abandoned)}
+	if err := ta.scanChunkDirs(context.Background(), time.Now().Add(-reconcileGrace), rep); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.StaleChunkUploads) != 1 || rep.StaleChunkUploads[0].Path != abandoned || rep.Quarantined != 1 {
+		t.Fatalf("stale chunk uploads %+v, quarantined %d; want only %s", rep.StaleChunkUploads, rep.Quarantined, abandoned)
+	}
+	if _, err := os.Stat(filepath.Join(chunkDir, abandoned)); !os.IsNotExist(err) {
+		t.Fatalf("abandoned chunk dir still present: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(chunkDir, rep.Quarantine, abandoned)); err != nil {
+		t.Fatalf("abandoned chunks not quarantined: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(chunkDir, active)); err != nil {
+		t.Fatalf("active upload quarantined: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/go-sql-driver/mysql"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// 数据访问层返回的错误类型，writeError 会把它们映射为 404/409/503
+var (
+	ErrNotFound    = errors.New("record not found")
+	ErrConflict    = errors.New("record conflicts with existing data")
+	ErrUnavailable = errors.New("database unavailable")
+)
+
+// dbError 把 MySQL/SQLite 驱动返回的错误归类到上面的类型，同时保留原始错误供日志使用
+func dbError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict) || errors.Is(err, ErrUnavailable) {
+		return err
+	}
+	var me *mysql.MySQLError
+	if errors.As(err, &me) {
+		switch me.Number {
+		case 1062, 1451, 1452: // 唯一键冲突、外键约束
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		case 1040, 1053, 1205, 1213: // 连接数已满、服务关闭、锁等待超时、死锁
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return err
+	}
+	var se *sqlite.Error
+	if errors.As(err, &se) {
+		switch se.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY, sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return err
+	}
+	var ne net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, sql.ErrConnDone) || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &ne) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
+// affected 根据 RowsAffected 判断写操作是否命中记录。DSN 中开启了 clientFoundRows，
+// 因此 UPDATE 返回的是匹配行数，值未变化的更新不会被误报为不存在。
+func affected(res sql.Result, err error) error {
+	if err != nil {
+		return dbError(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return dbError(err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type Resource struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	OrigName    string `json:"orig_name"`
+	Size        int64  `json:"size"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	FileType    string `json:"file_type"`
+	Uploader    string `json:"uploader"`
+	UploaderID  int    `json:"-"`
+	Downloads   int    `json:"downloads"`
+	Created     string `json:"created"`
+	Preview     string `json:"preview"`
+	SHA256      string `json:"sha256"`
+	Visibility  string `json:"visibility"`
+	StorageKey  string `json:"-"`
+}
+
+// ResourceFilter 是公开列表的筛选条件
+type ResourceFilter struct {
+	Category string
+	Search   string
+	Limit    int
+	Offset   int
+}
+
+type Announcement struct {
+	ID      int    `json:"id"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	Created string `json:"created"`
+}
+
+// UserCredentials 是登录时需要的用户信息
+type UserCredentials struct {
+	User
+	PasswordHash string
+	TokenVersion int
+}
+
+// UserRepo 读写 users 表。Update 只修改非 nil 的字段，并在密码或角色变化时递增 token_version。
+type UserRepo interface {
+	List(ctx context.Context) ([]User, error)
+	Get(ctx context.Context, id int) (User, error)
+	Credentials(ctx context.Context, username string) (UserCredentials, error)
+	Create(ctx context.Context, username, passwordHash, role string) (int64, error)
+	Update(ctx context.Context, id int, username, role, passwordHash *string) error
+	Rehash(ctx context.Context, id int, oldHash, newHash string) error
+	Delete(ctx context.Context, id int) error
+	Count(ctx context.Context) (int, error)
+}
+
+// ResourceRepo 读写 resources 表，只负责记录本身，不涉及存储中的对象
+type ResourceRepo interface {
+	List(ctx context.Context, f ResourceFilter) ([]Resource, int, error)
+	Get(ctx context.Context, id int) (Resource, error)
+	Create(ctx context.Context, res *Resource) (int64, error)
+	Update(ctx context.Context, id int, description, visibility *string) error
+	Delete(ctx context.Context, id int) error
+	Totals(ctx context.Context) (files int, size int64, downloads int, err error)
+}
+
+type AnnouncementRepo interface {
+	List(ctx context.Context, limit int) ([]Announcement, error)
+	Create(ctx context.Context, title, content string) (int64, error)
+	Delete(ctx context.Context, id int) error
+}
+
+// App 持有数据库连接和按驱动选择的仓储。HTTP 处理函数、后台任务和子命令都挂在 App 上，
+// 测试可以各自打开内存数据库、构造独立的 App 并行运行，也可以替换为其他仓储实现。
+type App struct {
+	db            *sql.DB
+	driver        string
+	users         UserRepo
+	resources     ResourceRepo
+	announcements AnnouncementRepo
+}
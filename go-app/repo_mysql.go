@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+type mysqlUserRepo struct{ db *sql.DB }
+
+func (r *mysqlUserRepo) List(ctx context.Context) ([]User, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id,username,role,created_at FROM users ORDER BY id")
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.Created); err != nil {
+			return nil, dbError(err)
+		}
+		users = append(users, u)
+	}
+	return users, dbError(rows.Err())
+}
+
+func (r *mysqlUserRepo) Get(ctx context.Context, id int) (User, error) {
+	var u User
+	err := r.db.QueryRowContext(ctx, "SELECT id,username,role,created_at FROM users WHERE id=?", id).
+		Scan(&u.ID, &u.Username, &u.Role, &u.Created)
+	return u, dbError(err)
+}
+
+func (r *mysqlUserRepo) Credentials(ctx context.Context, username string) (UserCredentials, error) {
+	var c UserCredentials
+	err := r.db.QueryRowContext(ctx, `SELECT id,username,role,created_at,password,token_version
+		FROM users WHERE username=?`, username).
+		Scan(&c.ID, &c.Username, &c.Role, &c.Created, &c.PasswordHash, &c.TokenVersion)
+	return c, dbError(err)
+}
+
+func (r *mysqlUserRepo) Create(ctx context.Context, username, passwordHash, role string) (int64, error) {
+	res, err := r.db.ExecContext(ctx, "INSERT INTO users (username,password,role) VALUES (?,?,?)",
+		username, passwordHash, role)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return res.LastInsertId()
+}
+
+// Update 修改用户名和角色，passwordHash 非空时同时修改密码。
+// 密码或角色变化都会递增 token_version，使已签发的访问令牌失效。
+func (r *mysqlUserRepo) Update(ctx context.Context, id int, username, role, passwordHash *string) error {
+	// token_version 必须放在最前面：MySQL 按顺序赋值，之后的表达式读到的是已更新的列
+	var set []string
+	var args []interface{}
+	switch {
+	case passwordHash != nil:
+		set = append(set, "token_version=token_version+1")
+	case role != nil:
+		set = append(set, "token_version=token_version+(CASE WHEN role<>? THEN 1 ELSE 0 END)")
+		args = append(args, *role)
+	}
+	if username != nil {
+		set = append(set, "username=?")
+		args = append(args, *username)
+	}
+	if passwordHash != nil {
+		set = append(set, "password=?")
+		args = append(args, *passwordHash)
+	}
+	if role != nil {
+		set = append(set, "role=?")
+		args = append(args, *role)
+	}
+	if len(set) == 0 {
+		var n int
+		return dbError(r.db.QueryRowContext(ctx, "SELECT id FROM users WHERE id=?", id).Scan(&n))
+	}
+	return affected(r.db.ExecContext(ctx, "UPDATE users SET "+strings.Join(set, ",")+" WHERE id=?",
+		append(args, id)...))
+}
+
+// Rehash 在登录时把旧哈希升级为新算法；oldHash 用于避免覆盖并发修改的密码
+func (r *mysqlUserRepo) Rehash(ctx context.Context, id int, oldHash, newHash string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET password=? WHERE id=? AND password=?", newHash, id, oldHash)
+	return dbError(err)
+}
+
+func (r *mysqlUserRepo) Delete(ctx context.Context, id int) error {
+	return affected(r.db.ExecContext(ctx, "DELETE FROM users WHERE id=?", id))
+}
+
+func (r *mysqlUserRepo) Count(ctx context.Context) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&n)
+	return n, dbError(err)
+}
+
+type mysqlResourceRepo struct{ db *sql.DB }
+
+const resourceColumns = `r.id,r.name,r.orig_name,r.size,COALESCE(r.category,''),COALESCE(r.description,''),
+	COALESCE(r.file_type,''),COALESCE(u.username,''),COALESCE(r.uploader_id,0),COALESCE(r.downloads,0),
+	r.created_at,COALESCE(r.sha256,''),r.visibility,COALESCE(r.storage_key,'')`
+
+func scanResource(s rowScanner) (Resource, error) {
+	var res Resource
+	err := s.Scan(&res.ID, &res.Name, &res.OrigName, &res.Size, &res.Category, &res.Description,
+		&res.FileType, &res.Uploader, &res.UploaderID, &res.Downloads, &res.Created, &res.SHA256,
+		&res.Visibility, &res.StorageKey)
+	res.Preview = getPreviewType(res.FileType)
+	return res, err
+}
+
+// List 返回公开资源的一页以及满足条件的总数
+func (r *mysqlResourceRepo) List(ctx context.Context, f ResourceFilter) ([]Resource, int, error) {
+	where := " WHERE r.visibility='public'"
+	var args []interface{}
+	if f.Category != "" {
+		where += " AND r.category=?"
+		args = append(args, f.Category)
+	}
+	if f.Search != "" {
+		where += " AND (r.orig_name LIKE ? OR r.description LIKE ?)"
+		args = append(args, "%"+f.Search+"%", "%"+f.Search+"%")
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM resources r"+where, args...).Scan(&total); err != nil {
+		return nil, 0, dbError(err)
+	}
+	rows, err := r.db.QueryContext(ctx, "SELECT "+resourceColumns+
+		" FROM resources r LEFT JOIN users u ON r.uploader_id=u.id"+where+" ORDER BY r.id DESC LIMIT ? OFFSET ?",
+		append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return nil, 0, dbError(err)
+	}
+	defer rows.Close()
+	list := []Resource{}
+	for rows.Next() {
+		res, err := scanResource(rows)
+		if err != nil {
+			return nil, 0, dbError(err)
+		}
+		list = append(list, res)
+	}
+	return list, total, dbError(rows.Err())
+}
+
+func (r *mysqlResourceRepo) Get(ctx context.Context, id int) (Resource, error) {
+	res, err := scanResource(r.db.QueryRowContext(ctx, "SELECT "+resourceColumns+
+		" FROM resources r LEFT JOIN users u ON r.uploader_id=u.id WHERE r.id=?", id))
+	return res, dbError(err)
+}
+
+// Create 写入新资源，res.Name 与 res.StorageKey 相同（都是存储 key）
+func (r *mysqlResourceRepo) Create(ctx context.Context, res *Resource) (int64, error) {
+	visibility := res.Visibility
+	if visibility == "" {
+		visibility = "public"
+	}
+	var uploader interface{}
+	if res.UploaderID != 0 {
+		uploader = res.UploaderID
+	}
+	result, err := r.db.ExecContext(ctx, `INSERT INTO resources (name,orig_name,size,category,description,
+		storage_key,sha256,file_type,uploader_id,visibility) VALUES (?,?,?,?,?,?,?,?,?,?)`,
+		res.StorageKey, res.OrigName, res.Size, res.Category, res.Description, res.StorageKey,
+		res.SHA256, res.FileType, uploader, visibility)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return result.LastInsertId()
+}
+
+// Update 只修改非 nil 的字段，都为 nil 时不做任何操作
+func (r *mysqlResourceRepo) Update(ctx context.Context, id int, description, visibility *string) error {
+	var set []string
+	var args []interface{}
+	if description != nil {
+		set = append(set, "description=?")
+		args = append(args, *description)
+	}
+	if visibility != nil {
+		set = append(set, "visibility=?")
+		args = append(args, *visibility)
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	return affected(r.db.ExecContext(ctx, "UPDATE resources SET "+strings.Join(set, ",")+" WHERE id=?",
+		append(args, id)...))
+}
+
+func (r *mysqlResourceRepo) Delete(ctx context.Context, id int) error {
+	return affected(r.db.ExecContext(ctx, "DELETE FROM resources WHERE id=?", id))
+}
+
+// Totals 返回资源总数、总大小和总下载次数
+func (r *mysqlResourceRepo) Totals(ctx context.Context) (files int, size int64, downloads int, err error) {
+	err = r.db.QueryRowContext(ctx, "SELECT COUNT(*),COALESCE(SUM(size),0),COALESCE(SUM(downloads),0) FROM resources").
+		Scan(&files, &size, &downloads)
+	return files, size, downloads, dbError(err)
+}
+
+type mysqlAnnouncementRepo struct{ db *sql.DB }
+
+func (r *mysqlAnnouncementRepo) List(ctx context.Context, limit int) ([]Announcement, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id,title,content,created_at FROM announcements ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+	list := []Announcement{}
+	for rows.Next() {
+		var a Announcement
+		if err := rows.Scan(&a.ID, &a.Title, &a.Content, &a.Created); err != nil {
+			return nil, dbError(err)
+		}
+		list = append(list, a)
+	}
+	return list, dbError(rows.Err())
+}
+
+func (r *mysqlAnnouncementRepo) Create(ctx context.Context, title, content string) (int64, error) {
+	res, err := r.db.ExecContext(ctx, "INSERT INTO announcements (title,content) VALUES (?,?)", title, content)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return res.LastInsertId()
+}
+
+func (r *mysqlAnnouncementRepo) Delete(ctx context.Context, id int) error {
+	return affected(r.db.ExecContext(ctx, "DELETE FROM announcements WHERE id=?", id))
+}
@@ -0,0 +1,10 @@
+package main
+
+// SQLite 实现复用 MySQL 仓储中的标准 SQL，只覆盖用到 MySQL 专有语法的方法。
+// 时间列声明为 DATETIME，驱动读出的是 time.Time，与 MySQL 的 parseTime 一致。
+
+type sqliteUserRepo struct{ mysqlUserRepo }
+
+type sqliteResourceRepo struct{ mysqlResourceRepo }
+
+type sqliteAnnouncementRepo struct{ mysqlAnnouncementRepo }
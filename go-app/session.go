@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var refreshTTL = getEnvDuration("JWT_REFRESH_TTL", 30*24*time.Hour)
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if d, err := time.ParseDuration(getEnv(key, "")); err == nil && d > 0 {
+		return d
+	}
+	return defaultValue
+}
+
+func hashToken(t string) string {
+	h := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(h[:])
+}
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// issueRefreshToken 在 family 中签发新的刷新令牌；family 为空时开启新的登录会话
+func (a *App) issueRefreshToken(uid int, family string) (string, int64, error) {
+	if family == "" {
+		family = uuid.New().String()
+	}
+	token := randomToken(32)
+	res, err := a.db.Exec(`INSERT INTO refresh_tokens (user_id,token_hash,family_id,expires_at)
+		VALUES (?,?,?,?)`, uid, hashToken(token), family, time.Now().Add(refreshTTL))
+	if err != nil {
+		return "", 0, err
+	}
+	id, _ := res.LastInsertId()
+	return token, id, nil
+}
+
+// issueSession 返回登录/刷新接口共用的令牌响应
+func (a *App) issueSession(uid int, role string, version int, family string) (map[string]interface{}, error) {
+	access, err := generateToken(uid, role, version)
+	if err != nil {
+		return nil, err
+	}
+	refresh, _, err := a.issueRefreshToken(uid, family)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"token":         access,
+		"refresh_token": refresh,
+		"expires_in":    int(jwtTTL.Seconds()),
+	}, nil
+}
+
+func (a *App) revokeRefreshFamily(family string) error {
+	_, err := a.db.Exec("UPDATE refresh_tokens SET revoked_at=? WHERE family_id=? AND revoked_at IS NULL", time.Now(), family)
+	return dbError(err)
+}
+
+func (a *App) revokeUserRefreshTokens(uid int) error {
+	_, err := a.db.Exec("UPDATE refresh_tokens SET revoked_at=? WHERE user_id=? AND revoked_at IS NULL", time.Now(), uid)
+	return dbError(err)
+}
+
+// checkTokenVersion 比对令牌中的版本号与数据库中的当前值。
+// 角色或密码变更时 users.token_version 递增，此前签发的访问令牌随即失效。
+func (a *App) checkTokenVersion(uid, version int) error {
+	var current int
+	err := a.db.QueryRow("SELECT token_version FROM users WHERE id=?", uid).Scan(&current)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("user not found")
+	} else if err != nil {
+		return dbError(err)
+	}
+	if current != version {
+		return fmt.Errorf("token revoked")
+	}
+	return nil
+}
+
+func (a *App) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, r, apiMethodNotAllowed)
+		return
+	}
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	if req.RefreshToken == "" {
+		writeError(w, r, apiRefreshRequired)
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var uid int
+	var family string
+	var expires time.Time
+	var revoked sql.NullTime
+	err = tx.QueryRow(`SELECT id,user_id,family_id,expires_at,revoked_at FROM refresh_tokens
+		WHERE token_hash=?`+a.forUpdate(), hashToken(req.RefreshToken)).
+		Scan(&id, &uid, &family, &expires, &revoked)
+	if err == sql.ErrNoRows {
+		writeError(w, r, apiInvalidRefresh)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(dbError(err)))
+		return
+	}
+	if revoked.Valid {
+		// 已轮换或已吊销的令牌被再次使用，说明令牌可能泄露，整条链全部作废
+		tx.Rollback()
+		if err := a.revokeRefreshFamily(family); err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		writeError(w, r, apiRefreshReused)
+		return
+	}
+	if time.Now().After(expires) {
+		writeError(w, r, apiRefreshExpired)
+		return
+	}
+
+	var role string
+	var version int
+	if err := tx.QueryRow("SELECT role,token_version FROM users WHERE id=?", uid).Scan(&role, &version); err == sql.ErrNoRows {
+		writeError(w, r, apiInvalidRefresh)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(dbError(err)))
+		return
+	}
+	if _, err := tx.Exec("UPDATE refresh_tokens SET revoked_at=? WHERE id=?", time.Now(), id); err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+
+	resp, err := a.issueSession(uid, role, version, family)
+	if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	jsonResponse(w, resp)
+}
+
+// handleLogout 吊销当前刷新令牌所在的会话；all=true 时同时使该用户的所有访问令牌失效
+func (a *App) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, r, apiMethodNotAllowed)
+		return
+	}
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+		All          bool   `json:"all"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	p := principalFromRequest(r)
+
+	if req.RefreshToken != "" {
+		var family string
+		err := a.db.QueryRow("SELECT family_id FROM refresh_tokens WHERE token_hash=? AND user_id=?",
+			hashToken(strings.TrimSpace(req.RefreshToken)), p.UserID).Scan(&family)
+		if err == nil {
+			err = a.revokeRefreshFamily(family)
+		}
+		// 令牌不存在时视为已退出
+		if err != nil && err != sql.ErrNoRows {
+			writeError(w, r, apiDatabase.Wrap(dbError(err)))
+			return
+		}
+	}
+	if req.All {
+		_, err := a.db.Exec("UPDATE users SET token_version=token_version+1 WHERE id=?", p.UserID)
+		if err == nil {
+			err = a.revokeUserRefreshTokens(p.UserID)
+		}
+		if err != nil {
+			writeError(w, r, apiDatabase.Wrap(dbError(err)))
+			return
+		}
+	}
+	jsonResponse(w, map[string]string{"message": "已退出登录"})
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestLoginAndRefresh(t *testing.T) {
+	t.Parallel()
+	ta := newTestApp(t)
+	ta.createUser("alice", "user")
+
+	ta.expectError(ta.do("POST", "/api/login", "", map[string]string{"username": "alice", "password": "wrong"}),
+		401, "INVALID_CREDENTIALS")
+	ta.expectError(ta.do("POST", "/api/login", "", map[string]string{"username": "nobody", "password": testPassword}),
+		401, "INVALID_CREDENTIALS")
+
+	token, refresh := ta.login("alice")
+	var user struct {
+		Username string `json:"username"`
+	}
+	ta.expectJSON(ta.do("GET", "/api/user", token, nil), 200, &user)
+	if user.Username != "alice" {
+		t.Fatalf("username %q, want alice", user.Username)
+	}
+
+	var rotated struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	ta.expectJSON(ta.do("POST", "/api/token/refresh", "", map[string]string{"refresh_token": refresh}), 200, &rotated)
+	if rotated.Token == "" || rotated.RefreshToken == "" || rotated.RefreshToken == refresh {
+		t.Fatalf("refresh did not rotate the token: %+v", rotated)
+	}
+	ta.expectJSON(ta.do("GET", "/api/user", rotated.Token, nil), 200, nil)
+
+	// 旧令牌再次使用视为泄露，整条链作废，轮换出的新令牌也不能再用
+	ta.expectError(ta.do("POST", "/api/token/refresh", "", map[string]string{"refresh_token": refresh}),
+		401, "REFRESH_TOKEN_REUSED")
+	ta.expectError(ta.do("POST", "/api/token/refresh", "", map[string]string{"refresh_token": rotated.RefreshToken}),
+		401, "REFRESH_TOKEN_REUSED")
+	ta.expectError(ta.do("POST", "/api/token/refresh", "", map[string]string{"refresh_token": "bogus"}),
+		401, "INVALID_REFRESH_TOKEN")
+}
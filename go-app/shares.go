@@ -0,0 +1,324 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ShareLink struct {
+	ID           int        `json:"id"`
+	Slug         string     `json:"slug"`
+	ResourceID   int        `json:"resource_id"`
+	ResourceName string     `json:"resource_name"`
+	HasPassword  bool       `json:"has_password"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	MaxDownloads int        `json:"max_downloads"`
+	Downloads    int        `json:"downloads"`
+	Revoked      bool       `json:"revoked"`
+	URL          string     `json:"url"`
+	Created      string     `json:"created"`
+}
+
+// clientIP 优先使用 nginx 传入的 X-Real-IP
+func clientIP(r *http.Request) string {
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (a *App) logShareAccess(r *http.Request, linkID int, action string, status int) {
+	ua := r.UserAgent()
+	if len(ua) > 255 {
+		ua = ua[:255]
+	}
+	if _, err := a.db.Exec("INSERT INTO share_access_log (link_id,action,status,ip,user_agent) VALUES (?,?,?,?,?)",
+		linkID, action, status, clientIP(r), ua); err != nil {
+		reqLogger(r).Warn("share access log failed", "link_id", linkID, "err", err)
+	}
+}
+
+func shareURL(slug string) string {
+	return publicBaseURL + "/api/download/s/" + slug
+}
+
+// sharePassword 读取分享密码：X-Share-Password 请求头，或 POST 表单中的 password 字段。
+// 不接受 URL 参数，以免密码进入访问日志和浏览器历史。
+func sharePassword(r *http.Request) string {
+	if pw := r.Header.Get("X-Share-Password"); pw != "" {
+		return pw
+	}
+	if r.Method == "POST" {
+		return r.PostFormValue("password")
+	}
+	return ""
+}
+
+// resolveShareLink 校验分享链接并返回其指向的资源 ID。action 为 download 的完整 GET 请求会消耗一次下载次数。
+// 校验失败时已写入错误响应，调用方直接返回即可。
+func (a *App) resolveShareLink(w http.ResponseWriter, r *http.Request, slug, action string) (string, bool) {
+	var id, resourceID, maxDownloads, downloads int
+	var pwHash sql.NullString
+	var expires, revoked sql.NullTime
+	err := a.db.QueryRow(`SELECT id,resource_id,password_hash,expires_at,max_downloads,downloads,revoked_at
+		FROM share_links WHERE slug=?`, slug).
+		Scan(&id, &resourceID, &pwHash, &expires, &maxDownloads, &downloads, &revoked)
+	if err == sql.ErrNoRows {
+		writeError(w, r, apiShareNotFound)
+		return "", false
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(dbError(err)))
+		return "", false
+	}
+	deny := func(e *APIError) (string, bool) {
+		a.logShareAccess(r, id, action, e.Status)
+		writeError(w, r, e)
+		return "", false
+	}
+	if revoked.Valid {
+		return deny(apiShareRevoked)
+	}
+	if expires.Valid && time.Now().After(expires.Time) {
+		return deny(apiShareExpired)
+	}
+	if pwHash.Valid && pwHash.String != "" {
+		if ok, _ := verifyPassword(pwHash.String, sharePassword(r)); !ok {
+			return deny(apiSharePassword)
+		}
+	}
+	// 预览会完整输出图片、音视频和 PDF，又不计数，有次数限制的链接只允许下载
+	if action == "preview" && maxDownloads > 0 {
+		return deny(apiSharePreviewOff)
+	}
+	// HEAD 不消耗次数；已经下载过的链接，续传的后续分段也不是新的下载，否则有次数限制的链接
+	// 无法断点续传。次数用完后只有完成过计数下载的同一客户端可以续传。
+	// 带表单密码的 POST 与 GET 一样输出文件，同样计数。
+	if action == "download" && r.Method != "HEAD" {
+		if downloads > 0 && isRangeContinuation(r) {
+			if maxDownloads > 0 && downloads >= maxDownloads {
+				started, err := a.shareDownloadStarted(r, id)
+				if err != nil {
+					return deny(apiDatabase.Wrap(err))
+				} else if !started {
+					return deny(apiShareExhausted)
+				}
+			}
+			action = "resume"
+		} else {
+			err := affected(a.db.Exec(`UPDATE share_links SET downloads=downloads+1
+				WHERE id=? AND (max_downloads=0 OR downloads<max_downloads)`, id))
+			if errors.Is(err, ErrNotFound) {
+				return deny(apiShareExhausted)
+			} else if err != nil {
+				return deny(apiDatabase.Wrap(err))
+			}
+		}
+	}
+	a.logShareAccess(r, id, action, 200)
+	return strconv.Itoa(resourceID), true
+}
+
+// shareDownloadStarted 判断当前客户端（IP + User-Agent）是否已经通过该链接完成过一次计数的下载
+func (a *App) shareDownloadStarted(r *http.Request, linkID int) (bool, error) {
+	ua := r.UserAgent()
+	if len(ua) > 255 {
+		ua = ua[:255]
+	}
+	var n int
+	err := a.db.QueryRow(`SELECT COUNT(*) FROM share_access_log
+		WHERE link_id=? AND action='download' AND status=200 AND ip=? AND user_agent=?`,
+		linkID, clientIP(r), ua).Scan(&n)
+	return n > 0, dbError(err)
+}
+
+// handleShareInfo 处理 GET /api/s/{slug}，返回分享落地页需要的公开信息（不校验密码）
+func (a *App) handleShareInfo(w http.ResponseWriter, r *http.Request) {
+	slug := strings.TrimPrefix(r.URL.Path, "/api/s/")
+	var origName, ft string
+	var size int64
+	var pwHash sql.NullString
+	var expires, revoked sql.NullTime
+	var maxDownloads, downloads int
+	err := a.db.QueryRow(`SELECT r.orig_name,r.size,r.file_type,l.password_hash,l.expires_at,l.revoked_at,
+		l.max_downloads,l.downloads FROM share_links l JOIN resources r ON l.resource_id=r.id WHERE l.slug=?`, slug).
+		Scan(&origName, &size, &ft, &pwHash, &expires, &revoked, &maxDownloads, &downloads)
+	if err != nil && err != sql.ErrNoRows {
+		writeError(w, r, apiDatabase.Wrap(dbError(err)))
+		return
+	}
+	if err != nil || revoked.Valid || (expires.Valid && time.Now().After(expires.Time)) {
+		writeError(w, r, apiShareNotFound)
+		return
+	}
+	remaining, preview := -1, getPreviewType(ft)
+	if maxDownloads > 0 {
+		remaining, preview = maxDownloads-downloads, "none"
+	}
+	var expiresAt *time.Time
+	if expires.Valid {
+		expiresAt = &expires.Time
+	}
+	jsonResponse(w, map[string]interface{}{
+		"orig_name": origName, "size": size, "file_type": ft, "preview": preview,
+		"requires_password": pwHash.Valid && pwHash.String != "", "expires_at": expiresAt,
+		"remaining_downloads": remaining, "url": shareURL(slug),
+	})
+}
+
+// handleShares 处理 GET/POST /api/shares：列出或创建当前用户的分享链接
+func (a *App) handleShares(w http.ResponseWriter, r *http.Request) {
+	p := principalFromRequest(r)
+	if r.Method == "GET" {
+		rows, err := a.db.Query(`SELECT l.id,l.slug,l.resource_id,r.orig_name,COALESCE(l.password_hash,''),l.expires_at,
+			l.max_downloads,l.downloads,l.revoked_at,l.created_at
+			FROM share_links l JOIN resources r ON l.resource_id=r.id WHERE l.owner_id=? ORDER BY l.id DESC`, p.UserID)
+		if err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		defer rows.Close()
+		links := []ShareLink{}
+		for rows.Next() {
+			var l ShareLink
+			var pwHash string
+			var expires, revoked sql.NullTime
+			if err := rows.Scan(&l.ID, &l.Slug, &l.ResourceID, &l.ResourceName, &pwHash, &expires,
+				&l.MaxDownloads, &l.Downloads, &revoked, &l.Created); err != nil {
+				writeError(w, r, apiDatabase.Wrap(err))
+				return
+			}
+			l.HasPassword = pwHash != ""
+			if expires.Valid {
+				l.ExpiresAt = &expires.Time
+			}
+			l.Revoked = revoked.Valid
+			l.URL = shareURL(l.Slug)
+			links = append(links, l)
+		}
+		if err := rows.Err(); err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		jsonResponse(w, links)
+		return
+	}
+	if r.Method != "POST" {
+		writeError(w, r, apiMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ResourceID   int    `json:"resource_id"`
+		Password     string `json:"password"`
+		ExpiresIn    int    `json:"expires_in"`
+		MaxDownloads int    `json:"max_downloads"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	target, err := a.resources.Get(r.Context(), req.ResourceID)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, apiResourceNotFound)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	if !canModify(p, target.UploaderID) {
+		writeError(w, r, apiResourceForbidden)
+		return
+	}
+	if req.ExpiresIn < 0 || req.MaxDownloads < 0 {
+		writeError(w, r, apiInvalidShareArgs)
+		return
+	}
+
+	var pwHash interface{}
+	if req.Password != "" {
+		h, err := hashPassword(req.Password)
+		if err != nil {
+			writeError(w, r, apiPasswordTooLong)
+			return
+		}
+		pwHash = h
+	}
+	var expires *time.Time
+	if req.ExpiresIn > 0 {
+		t := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+		expires = &t
+	}
+	slug := randomToken(9)
+	res, err := a.db.Exec(`INSERT INTO share_links (slug,resource_id,owner_id,password_hash,expires_at,max_downloads)
+		VALUES (?,?,?,?,?,?)`, slug, req.ResourceID, p.UserID, pwHash, expires, req.MaxDownloads)
+	if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	id, _ := res.LastInsertId()
+	jsonResponse(w, map[string]interface{}{
+		"id": id, "slug": slug, "url": shareURL(slug), "expires_at": expires,
+		"max_downloads": req.MaxDownloads, "has_password": req.Password != "",
+	})
+}
+
+// handleShareOps 处理 /api/shares/{id}：GET 返回访问日志，DELETE 吊销链接
+func (a *App) handleShareOps(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/shares/")
+	var ownerID int
+	if err := a.db.QueryRow("SELECT owner_id FROM share_links WHERE id=?", id).Scan(&ownerID); err == sql.ErrNoRows {
+		writeError(w, r, apiShareNotFound)
+		return
+	} else if err != nil {
+		writeError(w, r, apiDatabase.Wrap(dbError(err)))
+		return
+	}
+	if !canModify(principalFromRequest(r), ownerID) {
+		writeError(w, r, apiShareForbidden)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		rows, err := a.db.Query(`SELECT action,status,ip,user_agent,created_at FROM share_access_log
+			WHERE link_id=? ORDER BY id DESC LIMIT 200`, id)
+		if err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		defer rows.Close()
+		logs := []map[string]interface{}{}
+		for rows.Next() {
+			var action, ip, ua, created string
+			var status int
+			if err := rows.Scan(&action, &status, &ip, &ua, &created); err != nil {
+				writeError(w, r, apiDatabase.Wrap(err))
+				return
+			}
+			logs = append(logs, map[string]interface{}{
+				"action": action, "status": status, "ip": ip, "user_agent": ua, "created": created,
+			})
+		}
+		if err := rows.Err(); err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		jsonResponse(w, logs)
+	case "DELETE":
+		// 已吊销的链接保持原吊销时间，重复吊销同样视为成功
+		if _, err := a.db.Exec("UPDATE share_links SET revoked_at=? WHERE id=? AND revoked_at IS NULL", time.Now(), id); err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		jsonResponse(w, map[string]string{"message": "已吊销"})
+	default:
+		writeError(w, r, apiMethodNotAllowed)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestShareDownloadLimit(t *testing.T) {
+	t.Parallel()
+	ta := newTestApp(t)
+	ta.createUser("alice", "user")
+	alice, _ := ta.login("alice")
+	id, _ := ta.upload(alice, "report.txt", []byte("0123456789"))
+
+	var share struct {
+		Slug string `json:"slug"`
+	}
+	ta.expectJSON(ta.do("POST", "/api/shares", alice, map[string]interface{}{
+		"resource_id": id, "password": "letmein", "max_downloads": 1,
+	}), 200, &share)
+	path := "/api/download/s/" + share.Slug
+	remaining := func() int {
+		var info struct {
+			Remaining int `json:"remaining_downloads"`
+		}
+		ta.expectJSON(ta.do("GET", "/api/s/"+share.Slug, "", nil), 200, &info)
+		return info.Remaining
+	}
+	if n := remaining(); n != 1 {
+		t.Fatalf("remaining %d, want 1", n)
+	}
+
+	// 密码只接受请求头或 POST 表单
+	ta.expectError(ta.do("GET", path, "", nil), 401, "SHARE_PASSWORD_INVALID")
+	ta.expectError(ta.do("GET", path+"?password=letmein", "", nil), 401, "SHARE_PASSWORD_INVALID")
+	ta.expectError(ta.do("GET", path, "", nil, "X-Share-Password", "wrong"), 401, "SHARE_PASSWORD_INVALID")
+
+	// HEAD 不消耗次数
+	ta.expectBody(ta.do("HEAD", path, "", nil, "X-Share-Password", "letmein"), 200)
+	if n := remaining(); n != 1 {
+		t.Fatalf("remaining %d after HEAD, want 1", n)
+	}
+
+	// 从 0 开始的 Range 是一次新的下载，之后的续传不再计数
+	body := ta.expectBody(ta.do("GET", path, "", nil, "X-Share-Password", "letmein", "Range", "bytes=0-3"), 206)
+	if string(body) != "0123" {
+		t.Fatalf("first range %q, want 0123", body)
+	}
+	if n := remaining(); n != 0 {
+		t.Fatalf("remaining %d after download, want 0", n)
+	}
+	body = ta.expectBody(ta.do("GET", path, "", nil, "X-Share-Password", "letmein", "Range", "bytes=4-"), 206)
+	if string(body) != "456789" {
+		t.Fatalf("continuation %q, want 456789", body)
+	}
+
+	ta.expectError(ta.do("GET", path, "", nil, "X-Share-Password", "letmein"), 410, "SHARE_EXHAUSTED")
+	ta.expectError(ta.do("GET", path, "", nil, "X-Share-Password", "letmein", "Range", "bytes=0-3"), 410, "SHARE_EXHAUSTED")
+	// 后缀区间可以取得整个文件，不是续传
+	ta.expectError(ta.do("GET", path, "", nil, "X-Share-Password", "letmein", "Range", "bytes=-100"), 410, "SHARE_EXHAUSTED")
+	ta.expectError(ta.do("GET", path, "", nil, "X-Share-Password", "letmein", "Range", "bytes=4-,-100"), 410, "SHARE_EXHAUSTED")
+	// 次数用完后，没有下载过的客户端也不能续传
+	ta.expectError(ta.do("GET", path, "", nil, "X-Share-Password", "letmein", "Range", "bytes=4-", "User-Agent", "other"),
+		410, "SHARE_EXHAUSTED")
+	// 预览会输出完整文件，有次数限制的链接不提供预览
+	ta.expectError(ta.do("GET", "/api/preview/s/"+share.Slug, "", nil, "X-Share-Password", "letmein"), 403, "SHARE_PREVIEW_DISABLED")
+}
+
+func TestShareSuffixRangeCounts(t *testing.T) {
+	t.Parallel()
+	ta := newTestApp(t)
+	ta.createUser("alice", "user")
+	alice, _ := ta.login("alice")
+	id, _ := ta.upload(alice, "report.txt", []byte("0123456789"))
+
+	var share struct {
+		Slug string `json:"slug"`
+	}
+	ta.expectJSON(ta.do("POST", "/api/shares", alice, map[string]interface{}{"resource_id": id, "max_downloads": 2}), 200, &share)
+	path := "/api/download/s/" + share.Slug
+
+	ta.expectBody(ta.do("GET", path, "", nil), 200)
+	body := ta.expectBody(ta.do("GET", path, "", nil, "Range", "bytes=-100"), 206)
+	if string(body) != "0123456789" {
+		t.Fatalf("suffix range %q, want the whole file", body)
+	}
+	ta.expectError(ta.do("GET", path, "", nil, "Range", "bytes=-100"), 410, "SHARE_EXHAUSTED")
+	var info struct {
+		Remaining int    `json:"remaining_downloads"`
+		Preview   string `json:"preview"`
+	}
+	ta.expectJSON(ta.do("GET", "/api/s/"+share.Slug, "", nil), 200, &info)
+	if info.Remaining != 0 || info.Preview != "none" {
+		t.Fatalf("remaining %d preview %q, want 0/none", info.Remaining, info.Preview)
+	}
+}
+
+func TestShareRevoke(t *testing.T) {
+	t.Parallel()
+	ta := newTestApp(t)
+	ta.createUser("alice", "user")
+	ta.createUser("bob", "user")
+	alice, _ := ta.login("alice")
+	bob, _ := ta.login("bob")
+	id, _ := ta.upload(alice, "report.txt", []byte("report"))
+
+	ta.expectError(ta.do("POST", "/api/shares", bob, map[string]interface{}{"resource_id": id}), 403, "RESOURCE_FORBIDDEN")
+	ta.expectError(ta.do("POST", "/api/shares", alice, map[string]interface{}{"resource_id": 999999}), 404, "RESOURCE_NOT_FOUND")
+
+	var share struct {
+		ID   int    `json:"id"`
+		Slug string `json:"slug"`
+	}
+	ta.expectJSON(ta.do("POST", "/api/shares", alice, map[string]interface{}{"resource_id": id}), 200, &share)
+	ta.expectBody(ta.do("GET", "/api/download/s/"+share.Slug, "", nil), 200)
+
+	ta.expectError(ta.do("DELETE", "/api/shares/"+strconv.Itoa(share.ID), bob, nil), 403, "SHARE_FORBIDDEN")
+	ta.expectJSON(ta.do("DELETE", "/api/shares/"+strconv.Itoa(share.ID), alice, nil), 200, nil)
+	ta.expectError(ta.do("GET", "/api/download/s/"+share.Slug, "", nil), 410, "SHARE_REVOKED")
+	ta.expectError(ta.do("GET", "/api/s/"+share.Slug, "", nil), 404, "SHARE_NOT_FOUND")
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 统计接口只读汇总表，汇总表由 statsRollupLoop 定期从 download_events 和 resources 重算：
+//
+//	stats_resource_daily  每天每个资源的计数下载次数与输出字节数
+//	stats_uploader_daily  每天每个上传者的上传数量与字节数
+//	stats_storage         按 category/file_type 的当前存储占用
+var statsRollupInterval = getEnvDuration("STATS_ROLLUP_INTERVAL", 5*time.Minute)
+
+const (
+	statsDateLayout = "2006-01-02"
+	statsMaxRange   = 3 * 366 * 24 * time.Hour
+)
+
+func (a *App) statsRollupLoop() {
+	for {
+		if err := a.rollupStats(); err != nil {
+			slog.Error("stats rollup failed", "err", err)
+		}
+		time.Sleep(statsRollupInterval)
+	}
+}
+
+// rollupStats 从每张日表已有的最后一天开始重算，之前的日期不再变化；重复执行结果相同。
+// created_at 先按前一天粗筛以便走索引（本地日期与存储时区最多差一天），再按本地日期精确过滤。
+func (a *App) rollupStats() error {
+	day := a.localDate("created_at")
+	steps := []struct{ table, query string }{
+		{"stats_resource_daily", `INSERT INTO stats_resource_daily (day,resource_id,downloads,bytes)
+			SELECT ` + day + `,resource_id,SUM(counted),SUM(bytes) FROM download_events
+			WHERE created_at>=? AND ` + day + `>=? GROUP BY ` + day + `,resource_id` +
+			a.onConflictUpdate("day,resource_id") +
+			"downloads=" + a.insertedValue("downloads") + ",bytes=" + a.insertedValue("bytes")},
+		{"stats_uploader_daily", `INSERT INTO stats_uploader_daily (day,uploader_id,uploads,bytes)
+			SELECT ` + day + `,COALESCE(uploader_id,0),COUNT(*),SUM(size) FROM resources
+			WHERE created_at>=? AND ` + day + `>=? GROUP BY ` + day + `,COALESCE(uploader_id,0)` +
+			a.onConflictUpdate("day,uploader_id") +
+			"uploads=" + a.insertedValue("uploads") + ",bytes=" + a.insertedValue("bytes")},
+	}
+	for _, s := range steps {
+		since := "1970-01-01"
+		var last *string
+		if err := a.db.QueryRow("SELECT " + a.dateString("MAX(day)") + " FROM " + s.table).Scan(&last); err != nil {
+			return err
+		}
+		if last != nil {
+			since = *last
+		}
+		d, err := time.Parse(statsDateLayout, since)
+		if err != nil {
+			return fmt.Errorf("%s: last day %q: %w", s.table, since, err)
+		}
+		if _, err := a.db.Exec(s.query, d.AddDate(0, 0, -1).Format(statsDateLayout), since); err != nil {
+			return fmt.Errorf("%s: %w", s.table, err)
+		}
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM stats_storage"); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO stats_storage (category,file_type,files,bytes)
+		SELECT COALESCE(category,''),COALESCE(file_type,''),COUNT(*),SUM(size) FROM resources
+		GROUP BY COALESCE(category,''),COALESCE(file_type,'')`)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// statsRange 解析 from/to（YYYY-MM-DD，含两端），默认最近 30 天
+func statsRange(r *http.Request) (time.Time, time.Time, error) {
+	q := r.URL.Query()
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if v := q.Get("to"); v != "" {
+		t, err := time.ParseInLocation(statsDateLayout, v, time.Local)
+		if err != nil {
+			return to, to, err
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -29)
+	if v := q.Get("from"); v != "" {
+		t, err := time.ParseInLocation(statsDateLayout, v, time.Local)
+		if err != nil {
+			return from, to, err
+		}
+		from = t
+	}
+	if from.After(to) || to.Sub(from) > statsMaxRange {
+		return from, to, fmt.Errorf("invalid range")
+	}
+	return from, to, nil
+}
+
+func statsLimit(r *http.Request) int {
+	n, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || n <= 0 {
+		return 10
+	}
+	return min(n, 100)
+}
+
+// handleStatsOps 处理管理员统计接口 /api/stats/{timeseries,top-resources,top-uploaders,storage}
+func (a *App) handleStatsOps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, r, apiMethodNotAllowed)
+		return
+	}
+	op := strings.TrimPrefix(r.URL.Path, "/api/stats/")
+	if op == "storage" {
+		a.handleStatsStorage(w, r)
+		return
+	}
+	from, to, err := statsRange(r)
+	if err != nil {
+		writeError(w, r, apiInvalidDateRange)
+		return
+	}
+	switch op {
+	case "timeseries":
+		a.handleStatsTimeseries(w, r, from, to)
+	case "top-resources":
+		a.handleStatsTopResources(w, r, from, to)
+	case "top-uploaders":
+		a.handleStatsTopUploaders(w, r, from, to)
+	default:
+		writeError(w, r, apiNotFound)
+	}
+}
+
+// handleStatsTimeseries 返回 metric（downloads 计数下载、uploads 上传数、bytes 下载流量）
+// 按 day/week 聚合的序列，没有数据的区间补 0；week 以周一为起点
+func (a *App) handleStatsTimeseries(w http.ResponseWriter, r *http.Request, from, to time.Time) {
+	metrics := map[string]string{
+		"downloads": "SUM(downloads) FROM stats_resource_daily",
+		"bytes":     "SUM(bytes) FROM stats_resource_daily",
+		"uploads":   "SUM(uploads) FROM stats_uploader_daily",
+	}
+	periods := map[string]string{
+		"day":  a.dateString("day"),
+		"week": a.dateString("DATE_SUB(day, INTERVAL WEEKDAY(day) DAY)"),
+	}
+	if a.driver == "sqlite" {
+		// strftime('%w') 以周日为 0，换算成距周一的天数
+		periods["week"] = "date(day,'-'||((CAST(strftime('%w',day) AS INTEGER)+6)%7)||' days')"
+	}
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = "downloads"
+	}
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+	expr, period := metrics[metric], periods[interval]
+	if expr == "" || period == "" {
+		writeError(w, r, apiInvalidMetric)
+		return
+	}
+
+	rows, err := a.db.Query(fmt.Sprintf(`SELECT %s AS period,%s
+		WHERE day BETWEEN ? AND ? GROUP BY period`, period, expr),
+		from.Format(statsDateLayout), to.Format(statsDateLayout))
+	if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	defer rows.Close()
+	values := map[string]int64{}
+	for rows.Next() {
+		var p string
+		var v int64
+		if err := rows.Scan(&p, &v); err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		values[p] = v
+	}
+
+	start, step := from, 1
+	if interval == "week" {
+		start = from.AddDate(0, 0, -((int(from.Weekday()) + 6) % 7))
+		step = 7
+	}
+	points := []map[string]interface{}{}
+	for d := start; !d.After(to); d = d.AddDate(0, 0, step) {
+		p := d.Format(statsDateLayout)
+		points = append(points, map[string]interface{}{"period": p, "value": values[p]})
+	}
+	jsonResponse(w, map[string]interface{}{
+		"metric": metric, "interval": interval,
+		"from": from.Format(statsDateLayout), "to": to.Format(statsDateLayout), "points": points,
+	})
+}
+
+func (a *App) handleStatsTopResources(w http.ResponseWriter, r *http.Request, from, to time.Time) {
+	rows, err := a.db.Query(`SELECT s.resource_id,r.orig_name,COALESCE(r.category,''),SUM(s.downloads) AS n,SUM(s.bytes)
+		FROM stats_resource_daily s JOIN resources r ON r.id=s.resource_id
+		WHERE s.day BETWEEN ? AND ? GROUP BY s.resource_id,r.orig_name,r.category
+		HAVING n>0 ORDER BY n DESC LIMIT ?`,
+		from.Format(statsDateLayout), to.Format(statsDateLayout), statsLimit(r))
+	if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	defer rows.Close()
+	list := []map[string]interface{}{}
+	for rows.Next() {
+		var id int
+		var name, category string
+		var downloads, bytes int64
+		if err := rows.Scan(&id, &name, &category, &downloads, &bytes); err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		list = append(list, map[string]interface{}{
+			"id": id, "orig_name": name, "category": category, "downloads": downloads, "bytes": bytes,
+		})
+	}
+	jsonResponse(w, list)
+}
+
+func (a *App) handleStatsTopUploaders(w http.ResponseWriter, r *http.Request, from, to time.Time) {
+	rows, err := a.db.Query(`SELECT s.uploader_id,u.username,SUM(s.uploads) AS n,SUM(s.bytes)
+		FROM stats_uploader_daily s JOIN users u ON u.id=s.uploader_id
+		WHERE s.day BETWEEN ? AND ? GROUP BY s.uploader_id,u.username
+		ORDER BY n DESC LIMIT ?`,
+		from.Format(statsDateLayout), to.Format(statsDateLayout), statsLimit(r))
+	if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	defer rows.Close()
+	list := []map[string]interface{}{}
+	for rows.Next() {
+		var id int
+		var username string
+		var uploads, bytes int64
+		if err := rows.Scan(&id, &username, &uploads, &bytes); err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		list = append(list, map[string]interface{}{
+			"id": id, "username": username, "uploads": uploads, "bytes": bytes,
+		})
+	}
+	jsonResponse(w, list)
+}
+
+// handleStatsStorage 返回按 category 与 file_type 的存储占用
+func (a *App) handleStatsStorage(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.db.Query("SELECT category,file_type,files,bytes FROM stats_storage ORDER BY bytes DESC")
+	if err != nil {
+		writeError(w, r, apiDatabase.Wrap(err))
+		return
+	}
+	defer rows.Close()
+	byCategory := map[string]map[string]int64{}
+	byType := map[string]map[string]int64{}
+	add := func(m map[string]map[string]int64, k string, files, bytes int64) {
+		if m[k] == nil {
+			m[k] = map[string]int64{}
+		}
+		m[k]["files"] += files
+		m[k]["bytes"] += bytes
+	}
+	for rows.Next() {
+		var category, ft string
+		var files, bytes int64
+		if err := rows.Scan(&category, &ft, &files, &bytes); err != nil {
+			writeError(w, r, apiDatabase.Wrap(err))
+			return
+		}
+		add(byCategory, category, files, bytes)
+		add(byType, ft, files, bytes)
+	}
+	jsonResponse(w, map[string]interface{}{"by_category": byCategory, "by_file_type": byType})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStatsRollup(t *testing.T) {
+	t.Parallel()
+	ta := newTestApp(t)
+	ta.createUser("root", "admin")
+	ta.createUser("alice", "user")
+	root, _ := ta.login("root")
+	alice, _ := ta.login("alice")
+	id, _ := ta.upload(alice, "a.txt", []byte("hello"))
+	ta.upload(alice, "b.txt", []byte("hi"))
+	ta.expectBody(ta.do("GET", fmt.Sprintf("/api/download/%d", id), alice, nil), 200)
+
+	// 重复执行结果相同
+	for i := 0; i < 2; i++ {
+		if err := ta.rollupStats(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	today := time.Now().Format(statsDateLayout)
+
+	var series struct {
+		Points []struct {
+			Period string `json:"period"`
+			Value  int64  `json:"value"`
+		} `json:"points"`
+	}
+	ta.expectJSON(ta.do("GET", "/api/stats/timeseries?metric=uploads&from="+today+"&to="+today, root, nil), 200, &series)
+	if len(series.Points) != 1 || series.Points[0].Period != today || series.Points[0].Value != 2 {
+		t.Fatalf("uploads today %+v, want 2", series.Points)
+	}
+	ta.expectJSON(ta.do("GET", "/api/stats/timeseries?metric=bytes&interval=week&to="+today, root, nil), 200, &series)
+	var total int64
+	for _, p := range series.Points {
+		if d, _ := time.Parse(statsDateLayout, p.Period); d.Weekday() != time.Monday {
+			t.Fatalf("week period %s does not start on Monday", p.Period)
+		}
+		total += p.Value
+	}
+	if total != 5 {
+		t.Fatalf("weekly download bytes sum to %d, want 5", total)
+	}
+
+	var top []struct {
+		ID        int   `json:"id"`
+		Downloads int64 `json:"downloads"`
+	}
+	ta.expectJSON(ta.do("GET", "/api/stats/top-resources", root, nil), 200, &top)
+	if len(top) != 1 || top[0].ID != id || top[0].Downloads != 1 {
+		t.Fatalf("top resources %+v, want resource %d with 1 download", top, id)
+	}
+	var uploaders []struct {
+		Username string `json:"username"`
+		Uploads  int64  `json:"uploads"`
+	}
+	ta.expectJSON(ta.do("GET", "/api/stats/top-uploaders", root, nil), 200, &uploaders)
+	if len(uploaders) != 1 || uploaders[0].Username != "alice" || uploaders[0].Uploads != 2 {
+		t.Fatalf("top uploaders %+v, want alice with 2", uploaders)
+	}
+	var storage struct {
+		ByFileType map[string]map[string]int64 `json:"by_file_type"`
+	}
+	ta.expectJSON(ta.do("GET", "/api/stats/storage", root, nil), 200, &storage)
+	var files, bytes int64
+	for _, v := range storage.ByFileType {
+		files += v["files"]
+		bytes += v["bytes"]
+	}
+	if files != 2 || bytes != 7 {
+		t.Fatalf("storage %+v, want 2 files and 7 bytes", storage.ByFileType)
+	}
+}
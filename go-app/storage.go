@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+type ObjectInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage 抽象文件的存放位置。key 是相对路径（如 "3f2a....zip"），数据库只保存 key。
+type Storage interface {
+	// Put 写入对象，size 未知时传 -1，返回实际写入的字节数
+	Put(ctx context.Context, key string, r io.Reader, size int64) (int64, error)
+	// Get 读取 [offset, offset+length) 区间，length < 0 表示读到末尾
+	Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+}
+
+// ObjectLister 由可以枚举全部对象的存储实现，对账任务用它查找没有记录的孤儿对象。
+// 以 "." 开头的目录（如隔离区）不会被遍历。
+type ObjectLister interface {
+	Walk(ctx context.Context, fn func(key string, info ObjectInfo) error) error
+}
+
+// ObjectMover 由可以直接移动对象的存储实现，未实现时通过复制再删除完成
+type ObjectMover interface {
+	Move(ctx context.Context, src, dst string) error
+}
+
+var storage Storage
+
+func initStorage() error {
+	switch driver := getEnv("STORAGE_DRIVER", "local"); driver {
+	case "local":
+		if err := os.MkdirAll(uploadDir, 0755); err != nil {
+			return err
+		}
+		storage = &LocalStorage{Root: uploadDir}
+	case "s3":
+		s, err := newS3Storage()
+		if err != nil {
+			return err
+		}
+		storage = s
+	default:
+		return fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+	return nil
+}
+
+func validKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "/") && !strings.Contains(key, "..") && !strings.Contains(key, "\\")
+}
+
+// LocalStorage 把对象保存在本地目录 Root 下
+type LocalStorage struct {
+	Root string
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64) (int64, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return 0, err
+	}
+	// 先写临时文件再重命名，失败时不会在目标位置留下半截文件
+	f, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("wrote %d bytes, expected %d", written, size)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return written, err
+	}
+	return written, nil
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return ObjectInfo{}, ErrObjectNotFound
+	} else if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+func (s *LocalStorage) Walk(ctx context.Context, fn func(key string, info ObjectInfo) error) error {
+	return filepath.WalkDir(s.Root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if p != s.Root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.Root, p)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), ObjectInfo{Size: fi.Size(), ModTime: fi.ModTime()})
+	})
+}
+
+func (s *LocalStorage) Move(ctx context.Context, src, dst string) error {
+	from, err := s.path(src)
+	if err != nil {
+		return err
+	}
+	to, err := s.path(dst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+// objectReader 把按区间读取的 Storage.Get 适配成 io.ReadSeeker，供 http.ServeContent 处理 Range 请求。
+// Seek 只记录位置，真正的读取在下一次 Read 时按当前位置发起。
+type objectReader struct {
+	ctx  context.Context
+	key  string
+	size int64
+	pos  int64
+	body io.ReadCloser
+}
+
+func (o *objectReader) Read(p []byte) (int, error) {
+	if o.pos >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		body, err := storage.Get(o.ctx, o.key, o.pos, -1)
+		if err != nil {
+			return 0, err
+		}
+		o.body = body
+	}
+	n, err := o.body.Read(p)
+	o.pos += int64(n)
+	return n, err
+}
+
+func (o *objectReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = o.pos + offset
+	case io.SeekEnd:
+		pos = o.size + offset
+	}
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+	if pos != o.pos && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.pos = pos
+	return pos, nil
+}
+
+func (o *objectReader) Close() error {
+	if o.body != nil {
+		return o.body.Close()
+	}
+	return nil
+}
+
+// serveObject 以 http.ServeFile 相同的语义（Range、If-Modified-Since 等）输出对象，
+// accel 模式下交给 nginx 输出。返回响应状态码和输出的字节数。
+func serveObject(w http.ResponseWriter, r *http.Request, key, name string) (int, int64) {
+	if deliveryMode == "accel" {
+		return accelRedirect(w, r, key)
+	}
+	info, err := storage.Stat(r.Context(), key)
+	if err != nil {
+		writeError(w, r, apiResourceNotFound)
+		return 404, 0
+	}
+	o := &objectReader{ctx: r.Context(), key: key, size: info.Size}
+	defer o.Close()
+	cw := &countingWriter{ResponseWriter: w, status: 200}
+	http.ServeContent(cw, r, name, info.ModTime, o)
+	return cw.status, cw.n
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (c *countingWriter) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// migrateStorageKeys 把旧资源 file_path 中的本地路径换算成相对 uploadDir 的 key。
+// 可重复执行，已有 key 的行不会被修改。
+func (a *App) migrateStorageKeys() error {
+	rows, err := a.db.Query("SELECT id,file_path FROM resources WHERE storage_key IS NULL AND file_path IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id  int
+		key string
+	}
+	var updates []pending
+	root, _ := filepath.Abs(uploadDir)
+	for rows.Next() {
+		var id int
+		var fp string
+		if err := rows.Scan(&id, &fp); err != nil {
+			rows.Close()
+			return err
+		}
+		abs, _ := filepath.Abs(fp)
+		rel, err := filepath.Rel(root, abs)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			// 容器内外工作目录不同时路径前缀对不上，退回到只取文件名
+			rel = filepath.Base(fp)
+		}
+		updates = append(updates, pending{id, filepath.ToSlash(rel)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, u := range updates {
+		if _, err := a.db.Exec("UPDATE resources SET storage_key=? WHERE id=?", u.key, u.id); err != nil {
+			return err
+		}
+	}
+	if len(updates) > 0 {
+		slog.Info("migrated storage keys", "resources", len(updates))
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Storage 适用于 AWS S3 及 MinIO 等兼容服务
+type S3Storage struct {
+	Client *minio.Client
+	Bucket string
+	Prefix string
+}
+
+func newS3Storage() (*S3Storage, error) {
+	endpoint := getEnv("S3_ENDPOINT", "")
+	bucket := getEnv("S3_BUCKET", "")
+	if endpoint == "" || bucket == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for the s3 storage driver")
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(getEnv("S3_ACCESS_KEY", ""), getEnv("S3_SECRET_KEY", ""), ""),
+		Secure: getEnv("S3_USE_SSL", "true") == "true",
+		Region: getEnv("S3_REGION", ""),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ok, err := client.BucketExists(context.Background(), bucket)
+	if err != nil {
+		return nil, fmt.Errorf("check bucket %s: %w", bucket, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("bucket %s does not exist", bucket)
+	}
+	return &S3Storage{Client: client, Bucket: bucket, Prefix: getEnv("S3_PREFIX", "")}, nil
+}
+
+func (s *S3Storage) object(key string) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return path.Join(s.Prefix, key), nil
+}
+
+func isS3NotFound(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NotFound"
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64) (int64, error) {
+	obj, err := s.object(key)
+	if err != nil {
+		return 0, err
+	}
+	// 大小未知时 minio 走分片上传，每片在内存中缓冲 PartSize 字节
+	info, err := s.Client.PutObject(ctx, s.Bucket, obj, r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		PartSize:    16 << 20,
+		NumThreads:  1,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	obj, err := s.object(key)
+	if err != nil {
+		return nil, err
+	}
+	opts := minio.GetObjectOptions{}
+	if offset > 0 || length >= 0 {
+		end := int64(0)
+		if length >= 0 {
+			if length == 0 {
+				return io.NopCloser(strings.NewReader("")), nil
+			}
+			end = offset + length - 1
+		}
+		if err := opts.SetRange(offset, end); err != nil {
+			return nil, err
+		}
+	}
+	// 用 Core 直接发出 GET：minio.Object 在 Stat 之后会丢掉 Range 头，读到的是整个对象
+	body, _, _, err := minio.Core{Client: s.Client}.GetObject(ctx, s.Bucket, obj, opts)
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	obj, err := s.object(key)
+	if err != nil {
+		return err
+	}
+	return s.Client.RemoveObject(ctx, s.Bucket, obj, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	obj, err := s.object(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := s.Client.StatObject(ctx, s.Bucket, obj, minio.StatObjectOptions{})
+	if err != nil {
+		if isS3NotFound(err) {
+			return ObjectInfo{}, ErrObjectNotFound
+		}
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+func (s *S3Storage) Walk(ctx context.Context, fn func(key string, info ObjectInfo) error) error {
+	prefix := ""
+	if s.Prefix != "" {
+		prefix = strings.TrimSuffix(s.Prefix, "/") + "/"
+	}
+	for obj := range s.Client.ListObjects(ctx, s.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		key := strings.TrimPrefix(obj.Key, prefix)
+		if dir := path.Dir(key); dir != "." && strings.Contains("/"+dir, "/.") {
+			continue
+		}
+		if err := fn(key, ObjectInfo{Size: obj.Size, ModTime: obj.LastModified}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Move 在服务端复制后删除源对象，数据不经过本进程。CopyObject 只能复制 5GiB 以内的对象，
+// 更大的对象由 ComposeObject 分片复制。
+func (s *S3Storage) Move(ctx context.Context, src, dst string) error {
+	from, err := s.object(src)
+	if err != nil {
+		return err
+	}
+	to, err := s.object(dst)
+	if err != nil {
+		return err
+	}
+	info, err := s.Client.StatObject(ctx, s.Bucket, from, minio.StatObjectOptions{})
+	if err != nil {
+		if isS3NotFound(err) {
+			return ErrObjectNotFound
+		}
+		return err
+	}
+	srcOpts := minio.CopySrcOptions{Bucket: s.Bucket, Object: from}
+	dstOpts := minio.CopyDestOptions{Bucket: s.Bucket, Object: to}
+	if info.Size > 5<<30 {
+		_, err = s.Client.ComposeObject(ctx, dstOpts, srcOpts)
+	} else {
+		_, err = s.Client.CopyObject(ctx, dstOpts, srcOpts)
+	}
+	if err != nil {
+		return err
+	}
+	return s.Client.RemoveObject(ctx, s.Bucket, from, minio.RemoveObjectOptions{})
+}